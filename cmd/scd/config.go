@@ -0,0 +1,250 @@
+package scd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sstehniy/scd/pkg/scd"
+)
+
+// configKey is a setting that can be stored in the config file. Its value
+// comes from the flag named flag when given, then from the environment
+// variable env, then from the config file, then from the flag's default.
+type configKey struct {
+	name        string
+	env         string
+	flag        string
+	description string
+	validate    func(value string) error
+}
+
+var configKeys = []configKey{
+	{name: "output_dir", env: "SCD_OUTPUT_DIR", flag: "output-dir", description: "Directory downloads are saved in"},
+	{name: "concurrency", env: "SCD_CONCURRENCY", flag: "concurrency", description: "Tracks of a playlist or album downloaded at once", validate: validatePositiveInt},
+	{name: "filename_template", env: "SCD_FILENAME_TEMPLATE", flag: "output", description: "Template for the path of each download", validate: validateTemplate},
+	{name: "proxy", env: "SCD_PROXY", flag: "proxy", description: "Proxy for the browser and downloads", validate: validateProxy},
+	{name: "browser_path", env: "SCD_BROWSER_PATH", flag: "browser", description: "Chrome or Chromium binary to launch"},
+	{name: "format", env: "SCD_FORMAT", flag: "format", description: "Preferred stream format with --api: aac, opus or mp3", validate: validateFormat},
+}
+
+func findConfigKey(name string) (configKey, error) {
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, nil
+		}
+	}
+	return configKey{}, fmt.Errorf("unknown config key %q", name)
+}
+
+func validatePositiveInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("%q is not a positive number", value)
+	}
+	return nil
+}
+
+func validateProxy(value string) error {
+	_, err := scd.NewHTTPClient(value, "")
+	return err
+}
+
+func validateTemplate(value string) error {
+	_, err := scd.ParseOutputTemplate(value)
+	return err
+}
+
+func validateFormat(value string) error {
+	switch value {
+	case "aac", "opus", "mp3":
+		return nil
+	}
+	return fmt.Errorf("format must be aac, opus or mp3, not %q", value)
+}
+
+// configPath returns the location of the config file in the XDG config
+// directory.
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scd", "config"), nil
+}
+
+// loadConfig reads the "key = value" lines of the config file. A missing
+// file is an empty config.
+func loadConfig() (map[string]string, error) {
+	values := map[string]string{}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNumber)
+		}
+		name = strings.TrimSpace(name)
+		if _, err := findConfigKey(name); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		values[name] = strings.TrimSpace(value)
+	}
+	return values, scanner.Err()
+}
+
+// saveConfig writes values to the config file, replacing it atomically.
+func saveConfig(values map[string]string) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	builder := strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(&builder, "%s = %s\n", name, values[name])
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(builder.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// setting returns the effective value of a config key for cmd.
+func setting(cmd *cobra.Command, config map[string]string, name string) string {
+	key, err := findConfigKey(name)
+	if err != nil {
+		panic(err)
+	}
+	flag := cmd.Flags().Lookup(key.flag)
+	if flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	if value, ok := os.LookupEnv(key.env); ok {
+		return value
+	}
+	if value, ok := config[name]; ok {
+		return value
+	}
+	if flag != nil {
+		return flag.DefValue
+	}
+	return ""
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show or change the settings stored in the config file",
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Args:  cobra.NoArgs,
+	Short: "Print the location of the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configPath()
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Args:  cobra.NoArgs,
+	Short: "List the available keys and their values in the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		for _, key := range configKeys {
+			fmt.Printf("%s = %s\t# %s (env %s)\n", key.name, config[key.name], key.description, key.env)
+		}
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Print the value of a key in the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := findConfigKey(args[0]); err != nil {
+			return err
+		}
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Println(config[args[0]])
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Args:  cobra.ExactArgs(2),
+	Short: "Store a value in the config file, or remove it when the value is empty",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := findConfigKey(args[0])
+		if err != nil {
+			return err
+		}
+		config, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		value := strings.TrimSpace(args[1])
+		if value == "" {
+			delete(config, key.name)
+			return saveConfig(config)
+		}
+		if key.validate != nil {
+			if err := key.validate(value); err != nil {
+				return fmt.Errorf("invalid %s: %w", key.name, err)
+			}
+		}
+		config[key.name] = value
+		return saveConfig(config)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configPathCmd, configListCmd, configGetCmd, configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
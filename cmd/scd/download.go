@@ -0,0 +1,95 @@
+package scd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sstehniy/scd/pkg/scd"
+)
+
+var flagCollections string
+var flagBatchFile string
+
+// readBatchFile reads the entries of a batch file, or of stdin when path
+// is "-".
+func readBatchFile(path string) ([]scd.BatchEntry, error) {
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = file
+	}
+	return scd.ReadBatch(input)
+}
+
+var downloadCmd = &cobra.Command{
+	Use:   "download [url or query]...",
+	Short: "Download tracks, playlists, albums and user profiles by url, or the first track found for a query",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && flagBatchFile == "" {
+			return fmt.Errorf("requires at least one url or a batch file (-a)")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		entries := []scd.BatchEntry{}
+		if flagBatchFile != "" {
+			batch, err := readBatchFile(flagBatchFile)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+			entries = batch
+		}
+		for _, arg := range args {
+			entries = append(entries, scd.BatchEntry{Text: arg})
+		}
+
+		client, closeClient, err := newClient(cmd)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+		defer closeClient()
+		if client.UserCollections, err = scd.ParseUserCollections(flagCollections); err != nil {
+			fmt.Println("Error: " + err.Error())
+			closeClient()
+			os.Exit(1)
+		}
+
+		failed := 0
+		for _, result := range client.DownloadBatch(ctx, entries) {
+			label := result.Text
+			if result.Line > 0 {
+				label = fmt.Sprintf("line %d: %s", result.Line, result.Text)
+			}
+			if result.Err != nil {
+				failed++
+				fmt.Println(scd.Colorize("red", "Failed "+label+": "+result.Err.Error()))
+				continue
+			}
+			tracks := fmt.Sprintf("%d tracks", result.Tracks)
+			if result.Tracks == 1 {
+				tracks = "1 track"
+			}
+			fmt.Println(scd.Colorize("green", "Downloaded "+label+" ("+tracks+")"))
+		}
+		if failed > 0 {
+			closeClient()
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addClientFlags(downloadCmd)
+	downloadCmd.Flags().StringVar(&flagCollections, "collections", string(scd.UserUploads), "Collections downloaded for user pages: uploads, albums, playlists, likes and/or reposts, comma separated")
+	downloadCmd.Flags().StringVarP(&flagBatchFile, "batch-file", "a", "", "File with one url or search query per line, or - for stdin; blank lines and lines starting with # are skipped")
+	rootCmd.AddCommand(downloadCmd)
+}
@@ -17,15 +17,30 @@ var searchCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Short: "Search for songs/playlists",
 	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		client, closeClient, err := newClient(cmd)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+		defer closeClient()
+		exit := func(code int) {
+			closeClient()
+			os.Exit(code)
+		}
 		searchString := args[0]
 		if flagT && flagP {
 			fmt.Println("Error: You can only use one of the flags -t or -p.")
-			os.Exit(1)
+			exit(1)
 		} else if flagT {
-			searchResults := scd.SearchSongsByTitle(searchString)
+			searchResults, err := client.SearchSongs(ctx, searchString)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				exit(1)
+			}
 			if len(searchResults) == 0 {
 				fmt.Println("Nothing found for your search query: " + searchString)
-				os.Exit(1)
+				exit(1)
 			} else {
 				fmt.Println("Search results for: " + searchString + ":")
 
@@ -65,15 +80,22 @@ var searchCmd = &cobra.Command{
 				fmt.Println("You select the song: " + selected.Title + " by " + selected.Author)
 				fmt.Println(scd.Colorize("yellow", "Track url: "+selected.Url))
 
-				scd.DownloadTrack(&selected, "")
+				if err := client.DownloadTrack(ctx, &selected, ""); err != nil {
+					fmt.Println(scd.Colorize("red", "Download failed: "+err.Error()))
+					exit(1)
+				}
 				fmt.Println(scd.Colorize("green", "Download complete!"))
 			}
 		} else if flagP {
 
-			searchResults := scd.SearchPlaylistsByTitle(searchString)
+			searchResults, err := client.SearchPlaylists(ctx, searchString)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				exit(1)
+			}
 			if len(searchResults) == 0 {
 				fmt.Println("Nothing found for your search query: " + searchString)
-				os.Exit(1)
+				exit(1)
 			} else {
 				fmt.Println("Search results for: " + searchString + ":")
 
@@ -99,14 +121,21 @@ var searchCmd = &cobra.Command{
 
 				fmt.Println("You select the playlist: " + selected.Title + " by " + selected.Author)
 				fmt.Println(scd.Colorize("yellow", "Playlist url: "+selected.Url))
-				scd.DownloadPlaylist(&selected)
+				if err := client.DownloadPlaylist(ctx, &selected); err != nil {
+					fmt.Println(scd.Colorize("red", "Download failed: "+err.Error()))
+					exit(1)
+				}
 				fmt.Println(scd.Colorize("green", "Download complete!"))
 			}
 		} else if flagA {
-			searchResults := scd.SearchAlbumsByTitle(searchString)
+			searchResults, err := client.SearchAlbums(ctx, searchString)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				exit(1)
+			}
 			if len(searchResults) == 0 {
 				fmt.Println("Nothing found for your search query: " + searchString)
-				os.Exit(1)
+				exit(1)
 			} else {
 				fmt.Println("Search results for: " + searchString + ":")
 
@@ -132,7 +161,10 @@ var searchCmd = &cobra.Command{
 
 				fmt.Println("You select the playlist: " + selected.Title + " by " + selected.Author)
 				fmt.Println(scd.Colorize("yellow", "Playlist url: "+selected.Url))
-				scd.DownloadAlbum(&selected)
+				if err := client.DownloadAlbum(ctx, &selected); err != nil {
+					fmt.Println(scd.Colorize("red", "Download failed: "+err.Error()))
+					exit(1)
+				}
 				fmt.Println(scd.Colorize("green", "Download complete!"))
 			}
 		}
@@ -143,5 +175,6 @@ func init() {
 	searchCmd.Flags().BoolVarP(&flagT, "title", "t", false, "Search for songs")
 	searchCmd.Flags().BoolVarP(&flagP, "playlist", "p", false, "Search for playlists")
 	searchCmd.Flags().BoolVarP(&flagA, "album", "a", false, "Search for albums")
+	addClientFlags(searchCmd)
 	rootCmd.AddCommand(searchCmd)
 }
@@ -0,0 +1,659 @@
+package scd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoClientID is returned when none of the web app's script bundles
+// contains a client_id.
+var ErrNoClientID = errors.New("no client_id found in the SoundCloud web app")
+
+// scriptPattern matches the script bundles referenced by the web app.
+var scriptPattern = regexp.MustCompile(`<script[^>]+src="([^"]+\.js)"`)
+
+// clientIDPattern matches a client_id assignment inside a script bundle.
+var clientIDPattern = regexp.MustCompile(`client_id\s*[:=]\s*"?([0-9A-Za-z]{32})\b`)
+
+// apiTracksPerRequest is the number of ids the tracks endpoint accepts at
+// once.
+const apiTracksPerRequest = 50
+
+// APIClient talks to the api-v2 endpoints the SoundCloud web app uses,
+// over plain HTTP instead of through a browser. Point BaseURL and SiteURL
+// at a local server to run it against canned responses.
+type APIClient struct {
+	// BaseURL is the root of the API. SoundCloudAPIURL is used when empty.
+	BaseURL string
+	// SiteURL is the web app whose script bundles are searched for a
+	// client_id. SoundCloudBaseURL is used when empty.
+	SiteURL string
+	// ClientID is used until the API rejects it, after which a new one is
+	// discovered. It is discovered on first use when empty.
+	ClientID string
+	// CacheFile keeps the discovered client_id between runs. Nothing is
+	// written to disk when empty.
+	CacheFile string
+	// HTTPClient sends the API requests. http.DefaultClient is used when
+	// nil.
+	HTTPClient *http.Client
+	// Format is the preferred stream codec: "aac", "opus" or "mp3". The
+	// best available stream is picked when empty or not offered.
+	Format string
+	// Retry controls how failed requests are retried.
+	Retry RetryPolicy
+	// Limiter paces the requests. Share it with the Client to limit all
+	// traffic together. Nothing is limited when nil.
+	Limiter *RateLimiter
+
+	mutex sync.Mutex
+}
+
+// NewAPIClient returns an APIClient that caches its client_id in the user
+// cache directory.
+func NewAPIClient() *APIClient {
+	api := &APIClient{}
+	if dir, err := os.UserCacheDir(); err == nil {
+		api.CacheFile = filepath.Join(dir, "scd", "client_id")
+	}
+	return api
+}
+
+// apiError is an unexpected API response status.
+type apiError struct {
+	status int
+	path   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("api request %s failed with status %d %s", e.path, e.status, http.StatusText(e.status))
+}
+
+type apiUser struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	PermalinkURL string `json:"permalink_url"`
+	AvatarURL    string `json:"avatar_url"`
+}
+
+type apiTranscoding struct {
+	URL     string `json:"url"`
+	Preset  string `json:"preset"`
+	Snipped bool   `json:"snipped"`
+	Quality string `json:"quality"`
+	Format  struct {
+		Protocol string `json:"protocol"`
+		MimeType string `json:"mime_type"`
+	} `json:"format"`
+}
+
+type apiTrack struct {
+	ID                 int64   `json:"id"`
+	Title              string  `json:"title"`
+	PermalinkURL       string  `json:"permalink_url"`
+	ArtworkURL         string  `json:"artwork_url"`
+	Genre              string  `json:"genre"`
+	Duration           int64   `json:"duration"`
+	FullDuration       int64   `json:"full_duration"`
+	ReleaseDate        string  `json:"release_date"`
+	DisplayDate        string  `json:"display_date"`
+	CreatedAt          string  `json:"created_at"`
+	Policy             string  `json:"policy"`
+	TrackAuthorization string  `json:"track_authorization"`
+	SecretToken        string  `json:"secret_token"`
+	User               apiUser `json:"user"`
+	Media              struct {
+		Transcodings []apiTranscoding `json:"transcodings"`
+	} `json:"media"`
+}
+
+type apiPlaylist struct {
+	ID           int64      `json:"id"`
+	Title        string     `json:"title"`
+	PermalinkURL string     `json:"permalink_url"`
+	ArtworkURL   string     `json:"artwork_url"`
+	IsAlbum      bool       `json:"is_album"`
+	TrackCount   int        `json:"track_count"`
+	SecretToken  string     `json:"secret_token"`
+	User         apiUser    `json:"user"`
+	Tracks       []apiTrack `json:"tracks"`
+}
+
+type apiCollection[T any] struct {
+	Collection []T    `json:"collection"`
+	NextHref   string `json:"next_href"`
+}
+
+func (a *APIClient) httpClient() *http.Client {
+	if a.HTTPClient != nil {
+		return a.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (a *APIClient) baseURL() string {
+	if a.BaseURL != "" {
+		return strings.TrimRight(a.BaseURL, "/")
+	}
+	return SoundCloudAPIURL
+}
+
+func (a *APIClient) siteURL() string {
+	if a.SiteURL != "" {
+		return strings.TrimRight(a.SiteURL, "/")
+	}
+	return SoundCloudBaseURL
+}
+
+// clientID returns the cached client_id, discovering one when there is
+// none yet.
+func (a *APIClient) clientID(ctx context.Context) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.ClientID != "" {
+		return a.ClientID, nil
+	}
+	if a.CacheFile != "" {
+		if data, err := os.ReadFile(a.CacheFile); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				a.ClientID = id
+				return id, nil
+			}
+		}
+	}
+
+	id, err := a.discoverClientID(ctx)
+	if err != nil {
+		return "", err
+	}
+	a.ClientID = id
+	if a.CacheFile != "" {
+		if err := os.MkdirAll(filepath.Dir(a.CacheFile), 0755); err == nil {
+			err = os.WriteFile(a.CacheFile, []byte(id+"\n"), 0644)
+		}
+		if err != nil {
+			log.Println("failed to cache client_id", err)
+		}
+	}
+	return id, nil
+}
+
+// invalidateClientID forgets id after the API rejected it, unless another
+// request already replaced it.
+func (a *APIClient) invalidateClientID(id string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.ClientID != id {
+		return
+	}
+	a.ClientID = ""
+	if a.CacheFile != "" {
+		os.Remove(a.CacheFile)
+	}
+}
+
+// discoverClientID searches the script bundles of the web app for a
+// client_id. The id lives in one of the last bundles, so they are searched
+// from the end.
+func (a *APIClient) discoverClientID(ctx context.Context) (string, error) {
+	site, err := url.Parse(a.siteURL() + "/")
+	if err != nil {
+		return "", err
+	}
+	page, err := a.fetch(ctx, site.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to load the web app: %w", err)
+	}
+
+	scripts := scriptPattern.FindAllStringSubmatch(string(page), -1)
+	for i := len(scripts) - 1; i >= 0; i-- {
+		scriptURL, err := site.Parse(scripts[i][1])
+		if err != nil {
+			continue
+		}
+		script, err := a.fetch(ctx, scriptURL.String())
+		if err != nil {
+			log.Println("failed to load script bundle", err)
+			continue
+		}
+		if match := clientIDPattern.FindSubmatch(script); match != nil {
+			return string(match[1]), nil
+		}
+	}
+	return "", ErrNoClientID
+}
+
+// fetch downloads rawURL, retrying temporary failures.
+func (a *APIClient) fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	var body []byte
+	err := a.Retry.do(ctx, func() error {
+		release, err := a.Limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json, text/html;q=0.9, */*;q=0.8")
+		resp, err := a.httpClient().Do(req)
+		if err != nil {
+			return &retryableError{err: err}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			path := req.URL.Path
+			return statusError(resp, &apiError{status: resp.StatusCode, path: path})
+		}
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return &retryableError{err: err}
+		}
+		return nil
+	})
+	return body, err
+}
+
+// get calls the API endpoint at path, which may also be a full url such as
+// a next_href, and decodes the response into v. A rejected client_id is
+// replaced once.
+func (a *APIClient) get(ctx context.Context, path string, query url.Values, v any) error {
+	endpoint := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		endpoint = a.baseURL() + path
+	}
+
+	for attempt := 0; ; attempt++ {
+		id, err := a.clientID(ctx)
+		if err != nil {
+			return err
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		values := u.Query()
+		for key, value := range query {
+			values[key] = value
+		}
+		values.Set("client_id", id)
+		u.RawQuery = values.Encode()
+
+		body, err := a.fetch(ctx, u.String())
+		var status *apiError
+		if errors.As(err, &status) && status.status == http.StatusUnauthorized && attempt == 0 {
+			a.invalidateClientID(id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("invalid api response from %s: %w", u.Path, err)
+		}
+		return nil
+	}
+}
+
+// resolve looks up the API object behind a soundcloud.com url.
+func (a *APIClient) resolve(ctx context.Context, pageURL string, v any) error {
+	return a.get(ctx, "/resolve", url.Values{"url": {pageURL}}, v)
+}
+
+// track fetches a track by id. Private tracks are only returned along
+// with their secret token.
+func (a *APIClient) track(ctx context.Context, id int64, secret string) (*apiTrack, error) {
+	query := url.Values{}
+	if secret != "" {
+		query.Set("secret_token", secret)
+	}
+	track := &apiTrack{}
+	if err := a.get(ctx, "/tracks/"+strconv.FormatInt(id, 10), query, track); err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+// tracks fetches the full objects of the given track ids, in their order.
+// Ids the API does not return are left out. The tracks of a private
+// playlist are only returned along with its id and secret token.
+func (a *APIClient) tracks(ctx context.Context, ids []int64, playlistID int64, secret string) ([]apiTrack, error) {
+	found := map[int64]apiTrack{}
+	for start := 0; start < len(ids); start += apiTracksPerRequest {
+		end := min(start+apiTracksPerRequest, len(ids))
+		list := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			list = append(list, strconv.FormatInt(id, 10))
+		}
+		query := url.Values{"ids": {strings.Join(list, ",")}}
+		if secret != "" {
+			query.Set("playlistId", strconv.FormatInt(playlistID, 10))
+			query.Set("playlistSecretToken", secret)
+		}
+		batch := []apiTrack{}
+		if err := a.get(ctx, "/tracks", query, &batch); err != nil {
+			return nil, err
+		}
+		for _, track := range batch {
+			found[track.ID] = track
+		}
+	}
+
+	output := []apiTrack{}
+	for _, id := range ids {
+		if track, ok := found[id]; ok {
+			output = append(output, track)
+		}
+	}
+	return output, nil
+}
+
+// playlist fetches a playlist or album with all of its tracks, from the
+// playlists endpoint when its id is known and by resolving its url
+// otherwise. The API only returns the first few tracks in full, the rest
+// are filled in through the tracks endpoint.
+func (a *APIClient) playlist(ctx context.Context, set setInfo) (*apiPlaylist, error) {
+	playlist := &apiPlaylist{}
+	var err error
+	if set.id != 0 {
+		query := url.Values{}
+		if set.secret != "" {
+			query.Set("secret_token", set.secret)
+		}
+		err = a.get(ctx, "/playlists/"+strconv.FormatInt(set.id, 10), query, playlist)
+	} else {
+		err = a.resolve(ctx, set.url, playlist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret := set.secret
+	if secret == "" {
+		secret = playlist.SecretToken
+	}
+
+	missing := []int64{}
+	for _, track := range playlist.Tracks {
+		if track.Title == "" {
+			missing = append(missing, track.ID)
+		}
+	}
+	if len(missing) == 0 {
+		return playlist, nil
+	}
+	full, err := a.tracks(ctx, missing, playlist.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int64]apiTrack{}
+	for _, track := range full {
+		byID[track.ID] = track
+	}
+	for i, track := range playlist.Tracks {
+		if filled, ok := byID[track.ID]; ok && track.Title == "" {
+			playlist.Tracks[i] = filled
+		}
+	}
+	return playlist, nil
+}
+
+// transcodingMIMETypes maps the formats accepted by APIClient.Format to the
+// mime type prefix of their streams.
+var transcodingMIMETypes = map[string]string{
+	"aac":  "audio/mp4",
+	"opus": "audio/ogg",
+	"mp3":  "audio/mpeg",
+}
+
+// transcoding picks the stream to download: an unencrypted, complete HLS
+// stream in the preferred format if offered, then high quality first,
+// preferring AAC over Opus over MP3.
+func (t *apiTrack) transcoding(format string) *apiTranscoding {
+	candidates := []apiTranscoding{}
+	for _, transcoding := range t.Media.Transcodings {
+		if transcoding.Format.Protocol == "hls" && !transcoding.Snipped {
+			candidates = append(candidates, transcoding)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	rank := func(transcoding apiTranscoding) int {
+		score := 0
+		if prefix, ok := transcodingMIMETypes[format]; ok && strings.HasPrefix(transcoding.Format.MimeType, prefix) {
+			score += 100
+		}
+		if transcoding.Quality == "hq" {
+			score += 10
+		}
+		switch {
+		case strings.HasPrefix(transcoding.Format.MimeType, "audio/mp4"):
+			score += 3
+		case strings.HasPrefix(transcoding.Format.MimeType, "audio/ogg"):
+			score += 2
+		case strings.HasPrefix(transcoding.Format.MimeType, "audio/mpeg"):
+			score += 1
+		}
+		return score
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return rank(candidates[i]) > rank(candidates[j])
+	})
+	return &candidates[0]
+}
+
+// available reports whether the full track can be streamed.
+func (t *apiTrack) available() bool {
+	return t.Policy != "BLOCK" && t.transcoding("") != nil
+}
+
+// year returns the release year of the track, or 0.
+func (t *apiTrack) year() int {
+	for _, date := range []string{t.ReleaseDate, t.DisplayDate, t.CreatedAt} {
+		if released, err := time.Parse(time.RFC3339, date); err == nil {
+			return released.Year()
+		}
+	}
+	return 0
+}
+
+// uploaded returns when the track was uploaded, or the zero time.
+func (t *apiTrack) uploaded() time.Time {
+	uploaded, _ := time.Parse(time.RFC3339, t.CreatedAt)
+	return uploaded
+}
+
+func (t *apiTrack) songData() SongData {
+	duration := t.FullDuration
+	if duration == 0 {
+		duration = t.Duration
+	}
+	artwork := t.ArtworkURL
+	if artwork == "" {
+		artwork = t.User.AvatarURL
+	}
+	return SongData{
+		ID:         t.ID,
+		Title:      t.Title,
+		Author:     t.User.Username,
+		Url:        t.PermalinkURL,
+		Available:  t.available(),
+		Genre:      t.Genre,
+		Year:       t.year(),
+		Uploaded:   t.uploaded(),
+		ArtworkURL: artwork,
+		Duration:   time.Duration(duration) * time.Millisecond,
+		Secret:     t.SecretToken,
+	}
+}
+
+// streamURL returns the HLS playlist url of a track and the mime type of
+// the stream.
+func (a *APIClient) streamURL(ctx context.Context, track *apiTrack) (string, string, error) {
+	transcoding := track.transcoding(a.Format)
+	if transcoding == nil {
+		return "", "", fmt.Errorf("%w: %s has no complete HLS stream", ErrNoStream, track.PermalinkURL)
+	}
+	query := url.Values{}
+	if track.TrackAuthorization != "" {
+		query.Set("track_authorization", track.TrackAuthorization)
+	}
+	stream := struct {
+		URL string `json:"url"`
+	}{}
+	if err := a.get(ctx, transcoding.URL, query, &stream); err != nil {
+		return "", "", err
+	}
+	if stream.URL == "" {
+		return "", "", fmt.Errorf("%w: empty stream url for %s", ErrNoStream, track.PermalinkURL)
+	}
+	return stream.URL, transcoding.Format.MimeType, nil
+}
+
+// songStreamURL returns the HLS playlist url of song, looking the track
+// up by id when known and by url otherwise, with its secret for private
+// tracks, and the mime type of the stream.
+func (a *APIClient) songStreamURL(ctx context.Context, song *SongData) (string, string, error) {
+	var track *apiTrack
+	var err error
+	if song.ID != 0 {
+		track, err = a.track(ctx, song.ID, song.Secret)
+	} else {
+		pageURL := song.Url
+		if song.Secret != "" && !strings.HasSuffix(pageURL, "/"+song.Secret) {
+			pageURL += "/" + song.Secret
+		}
+		track = &apiTrack{}
+		err = a.resolve(ctx, pageURL, track)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return a.streamURL(ctx, track)
+}
+
+// SearchTracks returns up to limit tracks matching query.
+func (a *APIClient) SearchTracks(ctx context.Context, query string, limit int) ([]SongData, error) {
+	result := apiCollection[apiTrack]{}
+	if err := a.get(ctx, "/search/tracks", searchQuery(query, limit), &result); err != nil {
+		return nil, err
+	}
+	output := []SongData{}
+	for _, track := range result.Collection {
+		output = append(output, track.songData())
+	}
+	return output, nil
+}
+
+// SearchPlaylists returns up to limit playlists matching query, albums
+// excluded.
+func (a *APIClient) SearchPlaylists(ctx context.Context, query string, limit int) ([]PlaylistData, error) {
+	result := apiCollection[apiPlaylist]{}
+	if err := a.get(ctx, "/search/playlists_without_albums", searchQuery(query, limit), &result); err != nil {
+		return nil, err
+	}
+	output := []PlaylistData{}
+	for _, playlist := range result.Collection {
+		if playlist.TrackCount == 0 {
+			continue
+		}
+		output = append(output, PlaylistData{
+			Title:      playlist.Title,
+			Author:     playlist.User.Username,
+			Url:        playlist.PermalinkURL,
+			TrackCount: playlist.TrackCount,
+			ArtworkURL: playlist.ArtworkURL,
+		})
+	}
+	return output, nil
+}
+
+// SearchAlbums returns up to limit albums matching query.
+func (a *APIClient) SearchAlbums(ctx context.Context, query string, limit int) ([]AlbumData, error) {
+	result := apiCollection[apiPlaylist]{}
+	if err := a.get(ctx, "/search/albums", searchQuery(query, limit), &result); err != nil {
+		return nil, err
+	}
+	output := []AlbumData{}
+	for _, album := range result.Collection {
+		if album.TrackCount == 0 {
+			continue
+		}
+		output = append(output, AlbumData{
+			Title:      album.Title,
+			Author:     album.User.Username,
+			Url:        album.PermalinkURL,
+			TrackCount: album.TrackCount,
+			ArtworkURL: album.ArtworkURL,
+		})
+	}
+	return output, nil
+}
+
+func searchQuery(query string, limit int) url.Values {
+	return url.Values{"q": {query}, "limit": {strconv.Itoa(limit)}}
+}
+
+// setTracks reads the tracks of a playlist or album.
+func (a *APIClient) setTracks(ctx context.Context, set setInfo) ([]SongData, int, error) {
+	playlist, err := a.playlist(ctx, set)
+	if err != nil {
+		return nil, 0, err
+	}
+	return setSongs(set, playlist)
+}
+
+// setSongs converts the tracks of a playlist or album, credited the same
+// way collectSetTracks credits them. Unavailable tracks are counted and
+// left out.
+func setSongs(set setInfo, playlist *apiPlaylist) ([]SongData, int, error) {
+	if len(playlist.Tracks) == 0 {
+		return nil, 0, errors.New("no tracks found")
+	}
+
+	artwork := set.artworkURL
+	if artwork == "" {
+		artwork = playlist.ArtworkURL
+	}
+	songs := []SongData{}
+	notAvailable := 0
+	for index, track := range playlist.Tracks {
+		song := track.songData()
+		if !song.Available {
+			notAvailable++
+			continue
+		}
+		if artwork != "" {
+			song.ArtworkURL = artwork
+		}
+		song.Playlist = set.title
+		song.Album = set.title
+		song.TrackNumber = index + 1
+		song.TrackTotal = len(playlist.Tracks)
+		if set.album {
+			song.Author = set.author
+			song.AlbumArtist = set.author
+		}
+		songs = append(songs, song)
+	}
+	return songs, notAvailable, nil
+}
@@ -0,0 +1,289 @@
+package scd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	staleClientID = "0000000000000000000000000000dead"
+	freshClientID = "a1b2c3d4e5f6a7b8c9d0a1b2c3d4e5f6"
+)
+
+// standInAPI mimics the web app and the api-v2 endpoints the APIClient
+// uses. Only freshClientID is accepted.
+type standInAPI struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	discoveries int
+	requests    []string
+}
+
+func newStandInAPI(t *testing.T) *standInAPI {
+	api := &standInAPI{}
+	track := func(id int) map[string]any {
+		return map[string]any{
+			"id": id, "title": fmt.Sprintf("Track %d", id), "permalink_url": fmt.Sprintf("https://soundcloud.com/artist/track-%d", id),
+			"user": map[string]any{"username": "Artist"}, "track_authorization": "auth-" + fmt.Sprint(id),
+			"media": map[string]any{"transcodings": []map[string]any{
+				{"url": api.URL + "/api/media/" + fmt.Sprint(id) + "/mp3", "quality": "sq", "format": map[string]any{"protocol": "hls", "mime_type": "audio/mpeg"}},
+				{"url": api.URL + "/api/media/" + fmt.Sprint(id) + "/opus", "quality": "sq", "format": map[string]any{"protocol": "hls", "mime_type": "audio/ogg; codecs=\"opus\""}},
+			}},
+		}
+	}
+	playlist := func() map[string]any {
+		// Only the first track is embedded in full, as the API does for
+		// long sets.
+		return map[string]any{
+			"id": 40, "kind": "playlist", "title": "Set", "permalink_url": "https://soundcloud.com/artist/sets/set", "track_count": 3,
+			"user": map[string]any{"username": "Artist"}, "tracks": []any{track(1), map[string]any{"id": 2}, map[string]any{"id": 3}},
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		api.mutex.Lock()
+		api.discoveries++
+		api.mutex.Unlock()
+		fmt.Fprint(w, `<html><script crossorigin src="/assets/vendor.js"></script><script crossorigin src="/assets/app.js"></script><script src="/assets/broken.js"></script></html>`)
+	})
+	mux.HandleFunc("/assets/vendor.js", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `var config={client_id:"`+freshClientID+`",env:"production"};`)
+	})
+	mux.HandleFunc("/assets/app.js", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `console.log("no id here")`)
+	})
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/api")
+		api.mutex.Lock()
+		api.requests = append(api.requests, path+"?"+r.URL.Query().Get("ids")+r.URL.Query().Get("secret_token"))
+		api.mutex.Unlock()
+		if r.URL.Query().Get("client_id") != freshClientID {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var body any
+		switch {
+		case path == "/search/tracks":
+			body = map[string]any{"collection": []any{track(1)}}
+		case path == "/resolve" && r.URL.Query().Get("url") == "https://soundcloud.com/artist/sets/set":
+			body = playlist()
+		case path == "/playlists/40":
+			body = playlist()
+		case path == "/tracks" && r.URL.Query().Get("ids") == "2,3":
+			body = []any{track(3), track(2)}
+		case path == "/tracks/1":
+			body = track(1)
+		case strings.HasPrefix(path, "/media/"):
+			if r.URL.Query().Get("track_authorization") != "auth-1" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			body = map[string]any{"url": "https://cf-hls-media.sndcdn.com" + path + "/playlist.m3u8"}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (s *standInAPI) client(cacheFile string) *APIClient {
+	return &APIClient{BaseURL: s.URL + "/api", SiteURL: s.URL, CacheFile: cacheFile, Retry: RetryPolicy{MaxAttempts: 1}}
+}
+
+func TestAPIClientIDDiscovery(t *testing.T) {
+	server := newStandInAPI(t)
+	cacheFile := filepath.Join(t.TempDir(), "scd", "client_id")
+
+	songs, err := server.client(cacheFile).SearchTracks(context.Background(), "track", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != 1 || songs[0].Title != "Track 1" {
+		t.Errorf("SearchTracks() = %+v, want Track 1", songs)
+	}
+	if data, err := os.ReadFile(cacheFile); err != nil || strings.TrimSpace(string(data)) != freshClientID {
+		t.Errorf("cached client_id = %q, %v, want %s", data, err, freshClientID)
+	}
+
+	// A second client reads the id from the cache.
+	if _, err := server.client(cacheFile).SearchTracks(context.Background(), "track", 10); err != nil {
+		t.Fatal(err)
+	}
+	if server.discoveries != 1 {
+		t.Errorf("client_id discovered %d times, want once", server.discoveries)
+	}
+}
+
+func TestAPIClientIDRefresh(t *testing.T) {
+	server := newStandInAPI(t)
+	cacheFile := filepath.Join(t.TempDir(), "client_id")
+	if err := os.WriteFile(cacheFile, []byte(staleClientID+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	api := server.client(cacheFile)
+	if _, err := api.SearchTracks(context.Background(), "track", 10); err != nil {
+		t.Fatal(err)
+	}
+	if api.ClientID != freshClientID {
+		t.Errorf("ClientID = %s, want %s", api.ClientID, freshClientID)
+	}
+	if data, _ := os.ReadFile(cacheFile); strings.TrimSpace(string(data)) != freshClientID {
+		t.Errorf("cached client_id = %q, want %s", data, freshClientID)
+	}
+	if server.discoveries != 1 {
+		t.Errorf("client_id discovered %d times, want once", server.discoveries)
+	}
+	want := []string{"/search/tracks?", "/search/tracks?"}
+	if strings.Join(server.requests, " ") != strings.Join(want, " ") {
+		t.Errorf("requests = %v, want %v", server.requests, want)
+	}
+}
+
+func TestAPISetTracks(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      setInfo
+		requests []string
+	}{
+		{
+			name:     "by url",
+			set:      setInfo{url: "https://soundcloud.com/artist/sets/set", title: "Set", author: "Artist"},
+			requests: []string{"/resolve?", "/tracks?2,3"},
+		},
+		{
+			name:     "by id",
+			set:      setInfo{id: 40, url: "https://soundcloud.com/artist/sets/set", title: "Set", author: "Artist"},
+			requests: []string{"/playlists/40?", "/tracks?2,3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newStandInAPI(t)
+			api := server.client("")
+			api.ClientID = freshClientID
+
+			songs, notAvailable, err := api.setTracks(context.Background(), test.set)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notAvailable != 0 {
+				t.Errorf("notAvailable = %d, want 0", notAvailable)
+			}
+			titles := []string{}
+			for _, song := range songs {
+				titles = append(titles, fmt.Sprintf("%d %s", song.TrackNumber, song.Title))
+			}
+			if got := strings.Join(titles, ", "); got != "1 Track 1, 2 Track 2, 3 Track 3" {
+				t.Errorf("tracks = %s", got)
+			}
+			if strings.Join(server.requests, " ") != strings.Join(test.requests, " ") {
+				t.Errorf("requests = %v, want %v", server.requests, test.requests)
+			}
+		})
+	}
+}
+
+func TestAPILookupByID(t *testing.T) {
+	server := newStandInAPI(t)
+	api := server.client("")
+	api.ClientID = freshClientID
+	client := &Client{API: api}
+
+	resource, err := client.Lookup(context.Background(), "https://w.soundcloud.com/player/?url=https%3A//api.soundcloud.com/playlists/40&secret_token=s-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource.Playlist == nil || resource.Playlist.Title != "Set" {
+		t.Errorf("Lookup() = %+v, want the playlist Set", resource)
+	}
+	if want := []string{"/playlists/40?s-abc"}; strings.Join(server.requests, " ") != strings.Join(want, " ") {
+		t.Errorf("requests = %v, want %v", server.requests, want)
+	}
+}
+
+func TestAPIStreamURL(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "/media/1/opus/playlist.m3u8"},
+		{"mp3", "/media/1/mp3/playlist.m3u8"},
+		{"aac", "/media/1/opus/playlist.m3u8"},
+	}
+	for _, test := range tests {
+		t.Run("format "+test.format, func(t *testing.T) {
+			server := newStandInAPI(t)
+			api := server.client("")
+			api.ClientID = freshClientID
+			api.Format = test.format
+
+			streamURL, _, err := api.songStreamURL(context.Background(), &SongData{ID: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "https://cf-hls-media.sndcdn.com" + test.want; streamURL != want {
+				t.Errorf("songStreamURL() = %s, want %s", streamURL, want)
+			}
+		})
+	}
+}
+
+func TestTranscodingSelection(t *testing.T) {
+	transcoding := func(url, protocol, mime, quality string, snipped bool) apiTranscoding {
+		t := apiTranscoding{URL: url, Quality: quality, Snipped: snipped}
+		t.Format.Protocol = protocol
+		t.Format.MimeType = mime
+		return t
+	}
+	mp3 := transcoding("mp3", "hls", "audio/mpeg", "sq", false)
+	opus := transcoding("opus", "hls", `audio/ogg; codecs="opus"`, "sq", false)
+	aac := transcoding("aac", "hls", `audio/mp4; codecs="mp4a.40.2"`, "sq", false)
+	aacHQ := transcoding("aac-hq", "hls", `audio/mp4; codecs="mp4a.40.2"`, "hq", false)
+	progressive := transcoding("progressive", "progressive", "audio/mpeg", "sq", false)
+	preview := transcoding("preview", "hls", "audio/mpeg", "sq", true)
+
+	tests := []struct {
+		name         string
+		transcodings []apiTranscoding
+		format       string
+		want         string
+	}{
+		{"AAC over Opus over MP3", []apiTranscoding{mp3, opus, aac}, "", "aac"},
+		{"high quality first", []apiTranscoding{aac, mp3, aacHQ}, "", "aac-hq"},
+		{"preferred format", []apiTranscoding{aacHQ, opus, mp3}, "mp3", "mp3"},
+		{"preferred format not offered", []apiTranscoding{mp3, opus}, "aac", "opus"},
+		{"progressive and previews skipped", []apiTranscoding{progressive, preview, mp3}, "", "mp3"},
+		{"nothing complete", []apiTranscoding{progressive, preview}, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			track := &apiTrack{}
+			track.Media.Transcodings = test.transcodings
+			got := ""
+			if picked := track.transcoding(test.format); picked != nil {
+				got = picked.URL
+			}
+			if got != test.want {
+				t.Errorf("transcoding(%q) = %q, want %q", test.format, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package scd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultArtworkSize is the artwork size used when Client.ArtworkSize is
+// empty.
+const DefaultArtworkSize = "t500x500"
+
+// artworkSizePattern matches the size suffix of SoundCloud artwork urls,
+// e.g. "-large.jpg" or "-t200x200.jpg".
+var artworkSizePattern = regexp.MustCompile(`-(large|small|tiny|mini|badge|crop|original|t\d+x\d+)(\.\w+)$`)
+
+// backgroundImagePattern extracts the url of a CSS background-image.
+var backgroundImagePattern = regexp.MustCompile(`url\(["']?([^"')]+)["']?\)`)
+
+// artworkURLForSize rewrites a SoundCloud artwork url to the given size,
+// such as "t500x500" or "original".
+func artworkURLForSize(url, size string) string {
+	if size == "" {
+		size = DefaultArtworkSize
+	}
+	return artworkSizePattern.ReplaceAllString(url, "-"+size+"$2")
+}
+
+// elementArtwork returns the artwork url of the child matching selector,
+// which SoundCloud renders as a background image.
+func elementArtwork(item Element, selector string) string {
+	el, err := item.Element(selector)
+	if err != nil {
+		return ""
+	}
+	return styleArtwork(el)
+}
+
+// styleArtwork returns the background image url of el.
+func styleArtwork(el Element) string {
+	style, _, _ := el.Attribute("style")
+	match := backgroundImagePattern.FindStringSubmatch(style)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// Artwork is a downloaded cover image.
+type Artwork struct {
+	MIME string
+	Data []byte
+}
+
+// ext returns the file extension matching the image type.
+func (a *Artwork) ext() string {
+	if a.MIME == "image/png" {
+		return "png"
+	}
+	return "jpg"
+}
+
+// maxCachedArtworks is the number of fetched artworks kept in memory.
+// Tracks are downloaded in set order, so the tracks of a set find its
+// artwork among the last few fetched.
+const maxCachedArtworks = 8
+
+// artworkCache shares artwork downloads between the tracks of a set, so
+// they make a single request. Only successful fetches are kept, and only
+// the most recent ones.
+type artworkCache struct {
+	mutex   sync.Mutex
+	entries map[string]*artworkEntry
+	// order lists the urls of the fetched artworks, oldest first.
+	order []string
+}
+
+// artworkEntry is an artwork being fetched or fetched. done is closed once
+// the fetch is over.
+type artworkEntry struct {
+	done    chan struct{}
+	artwork *Artwork
+	err     error
+}
+
+// start returns the entry of url and whether the caller has to fetch it.
+func (a *artworkCache) start(url string) (*artworkEntry, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.entries == nil {
+		a.entries = map[string]*artworkEntry{}
+	}
+	if entry, ok := a.entries[url]; ok {
+		return entry, false
+	}
+	entry := &artworkEntry{done: make(chan struct{})}
+	a.entries[url] = entry
+	return entry, true
+}
+
+// finish records the outcome of a fetch started with start, forgetting it
+// when it failed and evicting the oldest artwork when the cache is full.
+func (a *artworkCache) finish(url string, entry *artworkEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	defer close(entry.done)
+
+	if entry.err != nil {
+		delete(a.entries, url)
+		return
+	}
+	a.order = append(a.order, url)
+	if len(a.order) > maxCachedArtworks {
+		delete(a.entries, a.order[0])
+		a.order = a.order[1:]
+	}
+}
+
+// fetchArtwork downloads the artwork at url in the client's artwork size.
+func (c *Client) fetchArtwork(ctx context.Context, url string) (*Artwork, error) {
+	url = artworkURLForSize(url, c.ArtworkSize)
+	for {
+		entry, fetch := c.artworks.start(url)
+		if fetch {
+			entry.artwork, entry.err = c.downloadArtwork(ctx, url)
+			c.artworks.finish(url, entry)
+			return entry.artwork, entry.err
+		}
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// A failed fetch is tried again with this caller's context, as it
+		// may have been cancelled with the context of another.
+		if entry.err == nil {
+			return entry.artwork, nil
+		}
+	}
+}
+
+func (c *Client) downloadArtwork(ctx context.Context, url string) (*Artwork, error) {
+	data, err := c.fetchResource(ctx, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch artwork: %w", err)
+	}
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		return nil, fmt.Errorf("artwork %s is %s, not an image", url, mime)
+	}
+	return &Artwork{MIME: mime, Data: data}, nil
+}
+
+// writeFolderArtwork saves artwork as cover.jpg (or cover.png) in dir,
+// keeping an existing file.
+func writeFolderArtwork(dir string, artwork *Artwork) error {
+	path := filepath.Join(dir, "cover."+artwork.ext())
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return os.WriteFile(path, artwork.Data, 0644)
+}
+
+// id3PictureFrame builds an APIC frame holding artwork as front cover.
+func id3PictureFrame(artwork *Artwork) []byte {
+	data := append([]byte{0x03}, artwork.MIME...)
+	data = append(data, 0, 0x03, 0)
+	return id3Frame("APIC", append(data, artwork.Data...))
+}
+
+// mp4CoverItem builds a covr metadata item holding artwork.
+func mp4CoverItem(artwork *Artwork) []byte {
+	const jpegType, pngType = 13, 14
+	dataType := uint32(jpegType)
+	if artwork.MIME == "image/png" {
+		dataType = pngType
+	}
+	return mp4MetadataItem("covr", dataType, artwork.Data)
+}
+
+// vorbisPictureComment builds a METADATA_BLOCK_PICTURE comment holding
+// artwork as front cover.
+func vorbisPictureComment(artwork *Artwork) string {
+	block := binary.BigEndian.AppendUint32(nil, 3)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(artwork.MIME)))
+	block = append(block, artwork.MIME...)
+	// Empty description; width, height, depth and colors are unknown.
+	block = append(block, make([]byte, 4+16)...)
+	block = binary.BigEndian.AppendUint32(block, uint32(len(artwork.Data)))
+	block = append(block, artwork.Data...)
+	return "METADATA_BLOCK_PICTURE=" + base64.StdEncoding.EncodeToString(block)
+}
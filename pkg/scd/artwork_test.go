@@ -0,0 +1,56 @@
+package scd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// pngHeader is enough for http.DetectContentType to see an image.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func TestFetchArtworkCache(t *testing.T) {
+	requests := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(pngHeader)
+	}))
+	defer server.Close()
+	client := &Client{Retry: RetryPolicy{MaxAttempts: 1}}
+
+	// A cancelled fetch is not remembered.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.fetchArtwork(cancelled, server.URL+"/a-large.jpg"); err == nil {
+		t.Fatal("fetchArtwork() with a cancelled context succeeded")
+	}
+	artwork, err := client.fetchArtwork(context.Background(), server.URL+"/a-large.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artwork.MIME != "image/png" {
+		t.Errorf("MIME = %s, want image/png", artwork.MIME)
+	}
+	if _, err := client.fetchArtwork(context.Background(), server.URL+"/a-large.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("artwork fetched %d times, want once", requests.Load())
+	}
+
+	// Older artworks are evicted once the cache is full.
+	for i := 0; i < maxCachedArtworks; i++ {
+		if _, err := client.fetchArtwork(context.Background(), fmt.Sprintf("%s/%d-large.jpg", server.URL, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(client.artworks.entries) != maxCachedArtworks {
+		t.Errorf("cache holds %d artworks, want %d", len(client.artworks.entries), maxCachedArtworks)
+	}
+	if _, ok := client.artworks.entries[artworkURLForSize(server.URL+"/a-large.jpg", "")]; ok {
+		t.Error("oldest artwork was not evicted")
+	}
+}
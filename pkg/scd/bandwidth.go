@@ -0,0 +1,147 @@
+package scd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BandwidthLimiter caps the total number of bytes per second read by all
+// downloads sharing it. A nil *BandwidthLimiter does not limit anything.
+type BandwidthLimiter struct {
+	rate float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBandwidthLimiter returns a limiter allowing bytesPerSecond bytes per
+// second, with bursts of up to a tenth of a second's worth.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	return &BandwidthLimiter{rate: float64(bytesPerSecond), last: time.Now()}
+}
+
+// burst is the largest read allowed at once.
+func (b *BandwidthLimiter) burst() int {
+	return max(1, int(b.rate/10))
+}
+
+// waitN blocks until n bytes may be read.
+func (b *BandwidthLimiter) waitN(ctx context.Context, n int) error {
+	b.mutex.Lock()
+	now := time.Now()
+	b.tokens = math.Min(float64(b.burst()), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(0)
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mutex.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader reads through a BandwidthLimiter and counts the bytes it
+// reads.
+type throttledReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *BandwidthLimiter
+	counter *atomic.Int64
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if r.limiter != nil && len(p) > r.limiter.burst() {
+		p = p[:r.limiter.burst()]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.counter.Add(int64(n))
+		if r.limiter != nil {
+			if waitErr := r.limiter.waitN(r.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
+
+// ParseByteRate parses a rate such as "500K", "2M" or "1.5MB" into bytes
+// per second. Suffixes are binary: K is 1024 bytes.
+func ParseByteRate(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := 1.0
+	if number != "" {
+		switch number[len(number)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			number = number[:len(number)-1]
+		}
+	}
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", value)
+	}
+	return int64(parsed * multiplier), nil
+}
+
+// formatRate renders a transfer rate for progress output.
+func formatRate(bytesPerSecond float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	unit := 0
+	for bytesPerSecond >= 1024 && unit < len(units)-1 {
+		bytesPerSecond /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", bytesPerSecond, units[unit])
+}
+
+// rateMeter turns a growing byte count into a smoothed rate.
+type rateMeter struct {
+	counter  *atomic.Int64
+	lastTime time.Time
+	last     int64
+	rate     float64
+}
+
+func newRateMeter(counter *atomic.Int64) *rateMeter {
+	return &rateMeter{counter: counter, lastTime: time.Now(), last: counter.Load()}
+}
+
+// sample returns the current rate in bytes per second.
+func (m *rateMeter) sample() float64 {
+	now := time.Now()
+	total := m.counter.Load()
+	elapsed := now.Sub(m.lastTime).Seconds()
+	if elapsed <= 0 {
+		return m.rate
+	}
+	current := float64(total-m.last) / elapsed
+	m.rate = m.rate*0.7 + current*0.3
+	m.last, m.lastTime = total, now
+	return m.rate
+}
@@ -0,0 +1,178 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitWithin reports whether b lets n bytes through within timeout.
+func waitWithin(t *testing.T, b *BandwidthLimiter, n int, timeout time.Duration) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := b.waitN(ctx, n); err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("waitN() error = %v", err)
+		}
+		return false
+	}
+	return true
+}
+
+func TestBandwidthLimiterBurst(t *testing.T) {
+	b := NewBandwidthLimiter(1000)
+	if b.burst() != 100 {
+		t.Errorf("burst() = %d, want a tenth of the rate", b.burst())
+	}
+	if NewBandwidthLimiter(5).burst() != 1 {
+		t.Errorf("burst() = %d for a tiny rate, want 1", NewBandwidthLimiter(5).burst())
+	}
+
+	// The bucket starts empty.
+	if waitWithin(t, b, 100, 20*time.Millisecond) {
+		t.Fatal("the first read did not wait")
+	}
+
+	// After a long pause it holds a burst and no more.
+	b.mutex.Lock()
+	b.tokens = 0
+	b.last = time.Now().Add(-time.Hour)
+	b.mutex.Unlock()
+	if !waitWithin(t, b, 100, 20*time.Millisecond) {
+		t.Fatal("a read of one burst after a pause waited")
+	}
+	if waitWithin(t, b, 100, 20*time.Millisecond) {
+		t.Fatal("a second burst did not wait")
+	}
+}
+
+func TestBandwidthLimiterRefill(t *testing.T) {
+	b := NewBandwidthLimiter(1000)
+	b.mutex.Lock()
+	b.tokens = 0
+	b.last = time.Now().Add(-50 * time.Millisecond)
+	b.mutex.Unlock()
+	// 50ms refilled 50 bytes.
+	if !waitWithin(t, b, 50, 20*time.Millisecond) {
+		t.Fatal("a read of the refilled bytes waited")
+	}
+
+	start := time.Now()
+	if !waitWithin(t, b, 50, time.Second) {
+		t.Fatal("a read was not let through")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Errorf("a read of 50 bytes at 1000 B/s waited %v, want about 50ms", elapsed)
+	}
+}
+
+// chunkReader records the size of every read.
+type chunkReader struct {
+	reader io.Reader
+	sizes  []int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return r.reader.Read(p)
+}
+
+func TestThrottledReader(t *testing.T) {
+	data := bytes.Repeat([]byte("scd"), 10000)
+	source := &chunkReader{reader: bytes.NewReader(data)}
+	counter := &atomic.Int64{}
+	// 30000 bytes at 100000 B/s take about 300ms.
+	reader := &throttledReader{ctx: context.Background(), reader: source, limiter: NewBandwidthLimiter(100000), counter: counter}
+
+	start := time.Now()
+	read, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("reading 30000 bytes at 100000 B/s took %v, want about 300ms", elapsed)
+	}
+	if !bytes.Equal(read, data) || counter.Load() != int64(len(data)) {
+		t.Errorf("read %d bytes and counted %d, want %d", len(read), counter.Load(), len(data))
+	}
+	for _, size := range source.sizes {
+		if size > 10000 {
+			t.Fatalf("read %d bytes at once, more than a burst", size)
+		}
+	}
+
+	// Without a limiter bytes are only counted.
+	counter.Store(0)
+	reader = &throttledReader{ctx: context.Background(), reader: bytes.NewReader(data), counter: counter}
+	if read, err := io.ReadAll(reader); err != nil || len(read) != len(data) || counter.Load() != int64(len(data)) {
+		t.Errorf("ReadAll() = %d bytes, %v, counted %d", len(read), err, counter.Load())
+	}
+}
+
+func TestThrottledReaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &throttledReader{ctx: ctx, reader: bytes.NewReader(make([]byte, 1000)), limiter: NewBandwidthLimiter(10), counter: &atomic.Int64{}}
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(reader)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ReadAll() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the read did not stop when its context was cancelled")
+	}
+}
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"500", 500},
+		{"500K", 500 << 10},
+		{"500k", 500 << 10},
+		{"2M", 2 << 20},
+		{"1.5MB", 3 << 19},
+		{" 1G ", 1 << 30},
+		{"100B", 100},
+	}
+	for _, test := range tests {
+		if got, err := ParseByteRate(test.value); err != nil || got != test.want {
+			t.Errorf("ParseByteRate(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+	for _, value := range []string{"", "K", "fast", "-1M", "0", "1T"} {
+		if _, err := ParseByteRate(value); err == nil {
+			t.Errorf("ParseByteRate(%q) succeeded", value)
+		}
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want string
+	}{
+		{0, "0.0 B/s"},
+		{512, "512.0 B/s"},
+		{1536, "1.5 KiB/s"},
+		{3 << 20, "3.0 MiB/s"},
+		{5 << 40, "5120.0 GiB/s"},
+	}
+	for _, test := range tests {
+		if got := formatRate(test.rate); got != test.want {
+			t.Errorf("formatRate(%v) = %q, want %q", test.rate, got, test.want)
+		}
+	}
+}
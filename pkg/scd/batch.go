@@ -0,0 +1,154 @@
+package scd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BatchEntry is a line of a batch file: a SoundCloud url or a search
+// query.
+type BatchEntry struct {
+	// Line is the line number of the entry, or zero for entries that do
+	// not come from a file.
+	Line int
+	Text string
+}
+
+// BatchResult is the outcome of a batch entry.
+type BatchResult struct {
+	BatchEntry
+	// Tracks is the number of tracks the entry stood for.
+	Tracks int
+	Err    error
+}
+
+// ReadBatch reads the entries of a batch file, one per line. Blank lines
+// and lines starting with # are skipped.
+func ReadBatch(r io.Reader) ([]BatchEntry, error) {
+	entries := []BatchEntry{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entries = append(entries, BatchEntry{Line: line, Text: text})
+	}
+	return entries, scanner.Err()
+}
+
+// isLink reports whether a batch entry is a url rather than a search
+// query.
+func isLink(text string) bool {
+	if strings.Contains(text, "://") {
+		return true
+	}
+	u, err := parseLink(text)
+	return err == nil && (strings.HasSuffix(u.Host, "soundcloud.com") || shortLinkHosts[u.Host])
+}
+
+// queryJobs downloads the first available track SearchSongs finds for
+// query.
+func (c *Client) queryJobs(ctx context.Context, query string) ([]trackJob, int, error) {
+	stop := c.startSpinner("Searching for " + query)
+	songs, err := c.SearchSongs(ctx, query)
+	stop()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, song := range songs {
+		if song.Available {
+			return []trackJob{{song: song}}, 0, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("nothing available found for %q", query)
+}
+
+// DownloadBatch downloads every entry and reports how each one went. Urls
+// are handled like DownloadURL does and search queries download the first
+// available track SearchSongs finds. The tracks of all entries share one
+// pool of TrackWorkers downloads, which starts with the tracks of the first
+// entry while the later ones are still being looked up.
+func (c *Client) DownloadBatch(ctx context.Context, entries []BatchEntry) []BatchResult {
+	results := make([]BatchResult, len(entries))
+	var pool *downloadPool
+	jobs := []trackJob{}
+	// jobEntries holds the entries every job stands for, as a track listed
+	// by several entries is only downloaded once.
+	jobEntries := [][]int{}
+	queued := map[[2]string]int{}
+	jobErrs := map[int]error{}
+	finished := map[int]bool{}
+	warned := false
+	for index, entry := range entries {
+		results[index].BatchEntry = entry
+		if ctx.Err() != nil {
+			results[index].Err = ctx.Err()
+			continue
+		}
+
+		var entryJobs []trackJob
+		var skipped int
+		var err error
+		if isLink(entry.Text) {
+			entryJobs, skipped, err = c.urlJobs(ctx, entry.Text)
+		} else {
+			entryJobs, skipped, err = c.queryJobs(ctx, entry.Text)
+		}
+		results[index].Tracks = len(entryJobs)
+		results[index].Err = err
+		if skipped > 0 && !warned {
+			c.warnNotAvailable()
+			warned = true
+		}
+		for _, job := range entryJobs {
+			key := [2]string{job.song.Url, job.parentDir}
+			if first, ok := queued[key]; ok {
+				jobEntries[first] = append(jobEntries[first], index)
+				continue
+			}
+			if pool == nil {
+				pool = c.startDownloads(ctx, len(entryJobs), func(index int, err error) {
+					jobErrs[index] = err
+					finished[index] = true
+				})
+			}
+			queued[key] = len(jobs)
+			jobs = append(jobs, job)
+			jobEntries = append(jobEntries, []int{index})
+			pool.add(job)
+		}
+	}
+	if pool == nil {
+		return results
+	}
+	pool.wait()
+
+	entryErrs := make([][]error, len(entries))
+	for index, job := range jobs {
+		err := jobErrs[index]
+		if !finished[index] {
+			err = ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		for _, entry := range jobEntries[index] {
+			entryErrs[entry] = append(entryErrs[entry], fmt.Errorf("%s: %w", job.song.Url, err))
+		}
+	}
+	for index, errs := range entryErrs {
+		switch {
+		case len(errs) == 0:
+		case ctx.Err() != nil:
+			results[index].Err = ctx.Err()
+		default:
+			results[index].Err = errors.Join(append([]error{results[index].Err}, errs...)...)
+		}
+	}
+	return results
+}
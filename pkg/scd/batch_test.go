@@ -0,0 +1,187 @@
+package scd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadBatch(t *testing.T) {
+	input := "# favourites\r\n" +
+		"https://soundcloud.com/artist/track-1\r\n" +
+		"\n" +
+		"   \t\n" +
+		"  # https://soundcloud.com/artist/skipped\n" +
+		"  night drive  \n" +
+		"https://soundcloud.com/artist/sets/mix#fragment"
+
+	entries, err := ReadBatch(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BatchEntry{
+		{Line: 2, Text: "https://soundcloud.com/artist/track-1"},
+		{Line: 6, Text: "night drive"},
+		{Line: 7, Text: "https://soundcloud.com/artist/sets/mix#fragment"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ReadBatch() = %+v, want %+v", entries, want)
+	}
+}
+
+// newBatchServer stands in for the API and the CDN of public tracks. The
+// segments of tracks 8 and up are missing, and the lookup of track 2 waits
+// for the download of track 1 to start. It counts the requests for each
+// segment.
+func newBatchServer(t *testing.T) (*httptest.Server, map[string]int) {
+	var server *httptest.Server
+	track := func(id int) map[string]any {
+		return map[string]any{
+			"kind": "track", "id": id, "title": fmt.Sprintf("Track %d", id), "permalink_url": fmt.Sprintf("https://soundcloud.com/artist/track-%d", id),
+			"duration": 1000, "user": map[string]any{"username": "Artist"},
+			"media": map[string]any{"transcodings": []map[string]any{
+				{"url": server.URL + "/media/" + fmt.Sprint(id), "format": map[string]any{"protocol": "hls", "mime_type": "audio/mpeg"}},
+			}},
+		}
+	}
+	mutex := sync.Mutex{}
+	segments := map[string]int{}
+	started := make(chan struct{})
+	startOnce := sync.Once{}
+
+	set := func() map[string]any {
+		return map[string]any{"kind": "playlist", "id": 50, "title": "Broken", "permalink_url": "https://soundcloud.com/artist/sets/broken",
+			"track_count": 2, "user": map[string]any{"username": "Artist"}, "tracks": []any{track(8), track(9)}}
+	}
+
+	mux := http.NewServeMux()
+	handleJSON := func(pattern string, body func(r *http.Request) any) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(body(r))
+		})
+	}
+	handleJSON("/playlists/50", func(r *http.Request) any {
+		return set()
+	})
+	handleJSON("/tracks/{id}", func(r *http.Request) any {
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		return track(id)
+	})
+	handleJSON("/media/{id}", func(r *http.Request) any {
+		return map[string]any{"url": server.URL + "/hls/" + r.PathValue("id")}
+	})
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var v any
+		switch link := r.URL.Query().Get("url"); {
+		case link == "https://soundcloud.com/artist/sets/broken":
+			v = set()
+		case strings.HasPrefix(link, "https://soundcloud.com/artist/track-"):
+			id, err := strconv.Atoi(strings.TrimPrefix(link, "https://soundcloud.com/artist/track-"))
+			if err != nil {
+				break
+			}
+			if id == 2 {
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					http.Error(w, "track 1 was not downloaded before track 2 was looked up", http.StatusInternalServerError)
+					return
+				}
+			}
+			v = track(id)
+		}
+		if v == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	})
+	mux.HandleFunc("/hls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXTINF:1.0,\n/segment/%s\n#EXT-X-ENDLIST\n", r.PathValue("id"))
+	})
+	mux.HandleFunc("/segment/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		mutex.Lock()
+		segments[id]++
+		mutex.Unlock()
+		if id == "1" {
+			startOnce.Do(func() { close(started) })
+		}
+		if n, _ := strconv.Atoi(id); n >= 8 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(mp3Frame)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, segments
+}
+
+func TestDownloadBatch(t *testing.T) {
+	server, segments := newBatchServer(t)
+	dir := t.TempDir()
+	client := &Client{API: &APIClient{BaseURL: server.URL, ClientID: freshClientID, Retry: RetryPolicy{MaxAttempts: 1}}, OutputDir: dir, Retry: RetryPolicy{MaxAttempts: 1}}
+
+	entries := []BatchEntry{
+		{Line: 1, Text: "https://soundcloud.com/artist/track-1"},
+		// The same track again is downloaded once, for both entries.
+		{Line: 2, Text: "https://soundcloud.com/artist/track-1?si=abc"},
+		{Line: 3, Text: "https://soundcloud.com/artist/sets/broken"},
+		{Line: 4, Text: "https://soundcloud.com/artist/track-9"},
+		{Line: 5, Text: "https://soundcloud.com/artist/missing"},
+		{Line: 6, Text: "https://soundcloud.com/artist/track-2"},
+	}
+	results := client.DownloadBatch(context.Background(), entries)
+	if len(results) != len(entries) {
+		t.Fatalf("DownloadBatch() returned %d results, want %d", len(results), len(entries))
+	}
+
+	tests := []struct {
+		tracks int
+		// errs are the urls the error of the entry names, or nil when it
+		// succeeds.
+		errs []string
+	}{
+		{1, nil},
+		{1, nil},
+		{2, []string{"https://soundcloud.com/artist/track-8", "https://soundcloud.com/artist/track-9"}},
+		{1, []string{"https://soundcloud.com/artist/track-9"}},
+		{0, []string{"https://soundcloud.com/artist/missing"}},
+		{1, nil},
+	}
+	for index, test := range tests {
+		result := results[index]
+		if result.BatchEntry != entries[index] || result.Tracks != test.tracks {
+			t.Errorf("result %d = %+v, want %d tracks", index, result, test.tracks)
+		}
+		if (result.Err == nil) != (test.errs == nil) {
+			t.Errorf("result %d error = %v, want one naming %q", index, result.Err, test.errs)
+			continue
+		}
+		for _, url := range test.errs {
+			if !strings.Contains(result.Err.Error(), url) {
+				t.Errorf("result %d error = %v, want it to name %s", index, result.Err, url)
+			}
+		}
+	}
+
+	if segments["1"] != 1 || segments["2"] != 1 {
+		t.Errorf("segment requests = %v, want one for each track", segments)
+	}
+	for _, name := range []string{"Artist - Track 1.mp3", "Artist - Track 2.mp3"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
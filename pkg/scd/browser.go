@@ -1,74 +1,485 @@
 package scd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
 	"github.com/go-rod/rod/lib/proto"
 )
 
-func setupBrowser() *rod.Browser {
+// setupBrowser connects to the browser at ControlURL, or launches one
+// that runs until it is closed, independently of the request that caused
+// the launch. The launcher is nil for a remote browser.
+func (f *RodFetcher) setupBrowser() (*rod.Browser, *launcher.Launcher, error) {
+	if f.ControlURL != "" {
+		controlURL := f.ControlURL
+		if !strings.Contains(controlURL, "/devtools/browser/") {
+			resolved, err := launcher.ResolveURL(controlURL)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot resolve browser url %s: %w", controlURL, err)
+			}
+			controlURL = resolved
+		}
+		browser := f.configureBrowser(rod.New().ControlURL(controlURL))
+		if err := browser.Connect(); err != nil {
+			return nil, nil, fmt.Errorf("cannot connect to browser at %s: %w", controlURL, err)
+		}
+		return browser, nil, nil
+	}
+
 	ln := launcher.New().
 		Set("no-sandbox", "true").
-		Headless(true).
+		Headless(!f.Headful).
 		Set("disable-notifications").
 		// keep alive
 		Set("keep-alive", "true")
+	if f.BrowserPath != "" {
+		ln = ln.Bin(f.BrowserPath)
+	}
+	if f.Proxy != "" {
+		server, err := proxyServer(f.Proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		ln = ln.Proxy(server)
+	}
+	for _, flag := range f.Flags {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+		if hasValue {
+			ln = ln.Set(flags.Flag(name), value)
+		} else {
+			ln = ln.Set(flags.Flag(name))
+		}
+	}
 
 	ctl, err := ln.Launch()
 	if err != nil {
-		log.Println("cannot init launcher", err)
+		return nil, nil, fmt.Errorf("cannot init launcher: %w", err)
 	}
 
-	browser := rod.New().ControlURL(ctl).NoDefaultDevice()
+	browser := f.configureBrowser(rod.New().ControlURL(ctl))
 
 	err = browser.Connect()
 	if err != nil {
-		log.Println("cannot connect to browser", err)
+		ln.Kill()
+		return nil, nil, fmt.Errorf("cannot connect to browser: %w", err)
 	}
 
+	return browser, ln, nil
+}
+
+func (f *RodFetcher) configureBrowser(browser *rod.Browser) *rod.Browser {
+	browser = browser.NoDefaultDevice()
+	if f.SlowMotion > 0 {
+		browser = browser.SlowMotion(f.SlowMotion)
+	}
+	if f.Trace {
+		browser = browser.Trace(true)
+	}
 	return browser
 }
 
-func setupRequestHijacker(browser *rod.Browser, sourceChannel chan string) {
-	router := browser.HijackRequests()
+// openTab opens a blank tab bound to ctx.
+func openTab(ctx context.Context, browser *rod.Browser) (*rod.Page, error) {
+	page, err := browser.Context(ctx).Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open tab: %w", err)
+	}
+	if err := rod.Try(func() { page.MustWindowMaximize() }); err != nil {
+		page.Close()
+		return nil, fmt.Errorf("cannot open tab: %w", err)
+	}
+	return page, nil
+}
 
-	cancel := func() {
-		router.Remove("*")
-		router.MustStop()
+func loadPage(page *rod.Page, url string) error {
+	if err := page.Navigate(url); err != nil {
+		err = fmt.Errorf("cannot open page %s: %w", url, err)
+		// Navigation errors are network failures, such as
+		// net::ERR_CONNECTION_RESET.
+		if errors.As(err, new(*rod.ErrNavigation)) {
+			return &retryableError{err: err}
+		}
+		return err
 	}
-	requestHandler := func(ctx *rod.Hijack) {
-		if strings.Contains(ctx.Request.URL().String(), "m3u8") {
-			fmt.Println("found m3u8")
-			sourceChannel <- ctx.Request.URL().String()
-			close(sourceChannel)
-			cancel()
+	if err := page.WaitLoad(); err != nil {
+		return fmt.Errorf("cannot load page %s: %w", url, err)
+	}
+	return nil
+}
+
+const scrollTimeout = 15 * time.Second
+
+// streamTimeout is how long a track page is given to request its HLS
+// playlist. Removed, blocked and preview-only tracks never do.
+const streamTimeout = 30 * time.Second
+
+// DefaultTabs is the number of pages a RodFetcher keeps open at once when
+// Tabs is not set.
+const DefaultTabs = 4
+
+// ErrFetcherClosed is returned by a RodFetcher used after Close.
+var ErrFetcherClosed = errors.New("fetcher is closed")
+
+// RodFetcher is the default Fetcher. It drives a headless Chromium through
+// rod. The browser is launched on first use and shared by every page and
+// stream lookup until Close is called; at most Tabs pages are open at
+// once, further requests wait for a free tab.
+type RodFetcher struct {
+	// HTTPClient loads the responses the browser requests while a stream
+	// is being looked up, or all of them when Proxy or CABundle is set.
+	// http.DefaultClient is used when nil.
+	HTTPClient *http.Client
+	// Proxy is passed to the browser as its proxy server. Requests are
+	// then loaded through HTTPClient, which should use the same proxy:
+	// it can answer proxy authentication and trust an extra CA, which the
+	// browser cannot.
+	Proxy string
+	// CABundle is the PEM file of extra CA certificates HTTPClient
+	// trusts. When set, requests are loaded through HTTPClient, as the
+	// browser would reject the certificates it signs.
+	CABundle string
+	// Tabs is the number of pages open at once. DefaultTabs is used when
+	// zero.
+	Tabs int
+	// BrowserPath is the Chrome or Chromium binary to launch. When empty,
+	// rod uses the browser it manages, downloading it on first run.
+	BrowserPath string
+	// ControlURL connects to an already running browser instead of
+	// launching one, either by its DevTools websocket url or by the host
+	// and port of its remote debugging server. Close leaves that browser
+	// running.
+	ControlURL string
+	// Flags are extra command line switches for the launched browser, as
+	// "name" or "name=value".
+	Flags []string
+	// Headful shows the browser window instead of running headless.
+	Headful bool
+	// SlowMotion delays every input action, and Trace highlights them on
+	// the page and logs them, for watching a scrape step by step.
+	SlowMotion time.Duration
+	Trace      bool
+
+	mutex    sync.Mutex
+	browser  *rod.Browser
+	launcher *launcher.Launcher
+	tabs     chan struct{}
+	closed   bool
+	// cookiesHandled is set once the cookie banner was dealt with; the
+	// choice is stored in the shared browser profile.
+	cookiesHandled bool
+}
+
+func (f *RodFetcher) httpClient() *http.Client {
+	if f.HTTPClient != nil {
+		return f.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// start launches the shared browser if it is not running yet.
+func (f *RodFetcher) start() (*rod.Browser, chan struct{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return nil, nil, ErrFetcherClosed
+	}
+	if f.browser == nil {
+		browser, ln, err := f.setupBrowser()
+		if err != nil {
+			return nil, nil, err
+		}
+		f.browser, f.launcher = browser, ln
+		tabs := f.Tabs
+		if tabs <= 0 {
+			tabs = DefaultTabs
+		}
+		f.tabs = make(chan struct{}, tabs)
+	}
+	return f.browser, f.tabs, nil
+}
+
+// acquireTab waits for a free tab and opens it. When the fetcher has a
+// proxy or a CA bundle, or onLoad is set, every request of the tab is
+// loaded through the fetcher's HTTP client and onLoad is called with its
+// url.
+func (f *RodFetcher) acquireTab(ctx context.Context, onLoad func(url string)) (*rod.Page, func(), error) {
+	browser, tabs, err := f.start()
+	if err != nil {
+		return nil, nil, err
+	}
+	select {
+	case tabs <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	page, err := openTab(ctx, browser)
+	if err != nil {
+		<-tabs
+		return nil, nil, err
+	}
+
+	var router *rod.HijackRouter
+	if f.loadsThroughClient() || onLoad != nil {
+		router = page.HijackRequests()
+		err = router.Add("*", "", func(hijack *rod.Hijack) {
+			if err := hijack.LoadResponse(f.httpClient(), true); err != nil {
+				// Fail the request, or the page would get an empty
+				// response instead of a network error.
+				hijack.Response.Fail(proto.NetworkErrorReasonFailed)
+				return
+			}
+			if onLoad != nil {
+				onLoad(hijack.Request.URL().String())
+			}
+		})
+		if err != nil {
+			page.Context(context.Background()).Close()
+			<-tabs
+			return nil, nil, err
+		}
+		go router.Run()
+	}
+
+	release := func() {
+		if router != nil {
+			router.Stop()
 		}
+		// The tab is closed even when ctx is already done.
+		page.Context(context.Background()).Close()
+		<-tabs
+	}
+	return page, release, nil
+}
+
+// loadsThroughClient reports whether every request of the browser has to
+// be loaded through HTTPClient.
+func (f *RodFetcher) loadsThroughClient() bool {
+	return f.Proxy != "" || f.CABundle != ""
+}
 
-		ctx.ContinueRequest(&proto.FetchContinueRequest{})
+func (f *RodFetcher) Open(ctx context.Context, url string) (Page, error) {
+	page, release, err := f.acquireTab(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadPage(page, url); err != nil {
+		release()
+		return nil, err
 	}
 
-	router.MustAdd("*", requestHandler)
-	go router.Run()
+	f.mutex.Lock()
+	handleCookies := !f.cookiesHandled
+	f.cookiesHandled = true
+	f.mutex.Unlock()
+	if handleCookies {
+		if err := acceptCookiesAndHandlePage(page); err != nil {
+			log.Println("failed to accept cookies and handle page", err)
+		}
+	}
 
+	return &rodPage{page: page, release: release}, nil
 }
 
-func loadPage(browser *rod.Browser, url string) *rod.Page {
-	var page *rod.Page
-	err := rod.Try(func() {
-		page = browser.
-			MustPage(url).
-			MustWindowMaximize()
+func (f *RodFetcher) StreamURL(ctx context.Context, url string) (string, error) {
+	found := make(chan string, 1)
+	page, release, err := f.acquireTab(ctx, func(reqURL string) {
+		if strings.Contains(reqURL, "m3u8") {
+			select {
+			case found <- reqURL:
+			default:
+			}
+		}
 	})
+	if err != nil {
+		return "", err
+	}
+	defer release()
 
+	if err := loadPage(page, url); err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(streamTimeout)
+	defer timer.Stop()
+	select {
+	case streamURL := <-found:
+		return streamURL, nil
+	case <-timer.C:
+		return "", fmt.Errorf("%w: %s requested no playlist within %s", ErrNoStream, url, streamTimeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Close shuts the launched browser down and removes its profile. Pages
+// still open are closed with it. A browser connected through ControlURL
+// keeps running.
+func (f *RodFetcher) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.closed = true
+	if f.browser == nil {
+		return nil
+	}
+	browser, ln := f.browser, f.launcher
+	f.browser, f.launcher = nil, nil
+	if ln == nil {
+		return nil
+	}
+	err := browser.Close()
+	ln.Cleanup()
+	return err
+}
+
+type rodPage struct {
+	page *rod.Page
+	// release closes the tab and hands it back to the fetcher.
+	release func()
+}
+
+func (p *rodPage) Element(selector string) (Element, error) {
+	el, err := p.page.Sleeper(rod.NotFoundSleeper).Element(selector)
+	if err != nil {
+		return nil, rodError(err)
+	}
+	return &rodElement{el}, nil
+}
+
+func (p *rodPage) Elements(selector string) ([]Element, error) {
+	els, err := p.page.Elements(selector)
+	if err != nil {
+		return nil, err
+	}
+	return wrapRodElements(els), nil
+}
+
+func (p *rodPage) WaitElement(selectors ...string) error {
+	race := p.page.Race()
+	for _, selector := range selectors {
+		race = race.Element(selector)
+	}
+	_, err := race.Do()
+	return err
+}
+
+func (p *rodPage) ScrollUntil(selector string, count int) error {
+	for {
+		items, err := p.page.Elements(selector)
+		if err != nil {
+			return err
+		}
+		if len(items) >= count {
+			return nil
+		}
+		if len(items) == 0 {
+			return ErrElementNotFound
+		}
+		shape, err := items.Last().Shape()
+		if err != nil {
+			return err
+		}
+		box := shape.Box()
+		if err := p.page.Mouse.Scroll(0, box.Y+box.Height, 1); err != nil {
+			return err
+		}
+
+		err = p.page.Timeout(scrollTimeout).Wait(rod.Eval(`(s, n) => document.querySelectorAll(s).length > n`, selector, len(items)))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("stopped at %d of %d elements matching %s", len(items), count, selector)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *rodPage) Hydration() ([]byte, error) {
+	result, err := p.page.Eval(`() => JSON.stringify(window.__sc_hydration || null)`)
+	if err != nil {
+		return nil, err
+	}
+	data := result.Value.Str()
+	if data == "" || data == "null" {
+		return nil, ErrNoHydration
+	}
+	return []byte(data), nil
+}
+
+func (p *rodPage) Close() error {
+	p.release()
+	return nil
+}
+
+type rodElement struct {
+	el *rod.Element
+}
+
+func wrapRodElements(els rod.Elements) []Element {
+	output := make([]Element, len(els))
+	for i, el := range els {
+		output[i] = &rodElement{el}
+	}
+	return output
+}
+
+func rodError(err error) error {
+	if errors.Is(err, &rod.ErrElementNotFound{}) {
+		return ErrElementNotFound
+	}
+	return err
+}
+
+func (e *rodElement) Element(selector string) (Element, error) {
+	el, err := e.el.Element(selector)
+	if err != nil {
+		return nil, rodError(err)
+	}
+	return &rodElement{el}, nil
+}
+
+func (e *rodElement) Elements(selector string) ([]Element, error) {
+	els, err := e.el.Elements(selector)
 	if err != nil {
-		log.Println("cannot open page", err)
+		return nil, err
 	}
+	return wrapRodElements(els), nil
+}
 
-	page.MustWaitLoad()
+func (e *rodElement) Text() (string, error) {
+	return e.el.Text()
+}
 
-	return page
+func (e *rodElement) Attribute(name string) (string, bool, error) {
+	value, err := e.el.Attribute(name)
+	if err != nil || value == nil {
+		return "", false, err
+	}
+	return *value, true, nil
+}
+
+func (e *rodElement) Expand(selector string) error {
+	link, err := e.el.Element(selector)
+	if err != nil {
+		return rodError(err)
+	}
+	before, err := link.Text()
+	if err != nil {
+		return err
+	}
+	if err := link.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return err
+	}
+	return link.Wait(rod.Eval(`function (before) { return this.textContent !== before }`, before))
 }
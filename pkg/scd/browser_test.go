@@ -0,0 +1,21 @@
+package scd
+
+import "testing"
+
+func TestRodFetcherLoadsThroughClient(t *testing.T) {
+	tests := []struct {
+		fetcher *RodFetcher
+		want    bool
+	}{
+		{&RodFetcher{}, false},
+		{&RodFetcher{Proxy: "http://proxy.local:3128"}, true},
+		// A CA bundle alone still needs the client, which trusts it.
+		{&RodFetcher{CABundle: "corp-ca.pem"}, true},
+		{&RodFetcher{Proxy: "socks5://proxy.local:1080", CABundle: "corp-ca.pem"}, true},
+	}
+	for _, test := range tests {
+		if got := test.fetcher.loadsThroughClient(); got != test.want {
+			t.Errorf("loadsThroughClient() with proxy %q and CA bundle %q = %v, want %v", test.fetcher.Proxy, test.fetcher.CABundle, got, test.want)
+		}
+	}
+}
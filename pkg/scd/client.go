@@ -0,0 +1,187 @@
+package scd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client searches SoundCloud and downloads tracks, playlists and albums.
+// All methods take a context that can be used to cancel or time out the
+// underlying browser session and HTTP requests.
+type Client struct {
+	// HTTPClient is used for segment downloads and for requests the
+	// browser hands over to Go. http.DefaultClient is used when nil.
+	HTTPClient *http.Client
+	// Fetcher loads the pages that are scraped. A RodFetcher using
+	// HTTPClient is used when nil.
+	Fetcher Fetcher
+	// API, when set, is used for searches, playlists and stream lookups
+	// instead of loading pages through Fetcher.
+	API *APIClient
+	// ArtworkSize is the SoundCloud artwork size embedded into downloads,
+	// e.g. "t300x300", "t500x500" or "original". DefaultArtworkSize is
+	// used when empty.
+	ArtworkSize string
+	// Retry controls how failed page loads and downloads are retried.
+	// DefaultRetryPolicy is used for unset fields.
+	Retry RetryPolicy
+	// Limiter paces page loads, API calls and downloads. Nothing is
+	// limited when nil.
+	Limiter *RateLimiter
+	// Bandwidth caps the bytes per second of all downloads together.
+	// Nothing is limited when nil.
+	Bandwidth *BandwidthLimiter
+	// OutputDir is the directory downloads are saved in.
+	// ~/soundcloud-downloader is used when empty.
+	OutputDir string
+	// Template lays out the path of each download inside OutputDir. When
+	// nil, tracks are saved as "<artist> - <title>.<ext>" in the
+	// directory picked by the caller, such as "<playlist> - <author>" for
+	// playlists and albums.
+	Template *OutputTemplate
+	// ASCIINames transliterates file and directory names to ASCII.
+	// Otherwise they are kept as Unicode, normalized to NFC.
+	ASCIINames bool
+	// TrackWorkers is the number of tracks of a playlist or album
+	// downloaded at once. DefaultTrackWorkers is used when zero.
+	TrackWorkers int
+	// UserCollections are the collections DownloadURL downloads for a
+	// user page url. The uploads are downloaded when empty; urls of user
+	// subpages such as /likes download that collection.
+	UserCollections []UserCollection
+	// SegmentWorkers is the number of segments of a track fetched at
+	// once. DefaultSegmentWorkers is used when zero.
+	SegmentWorkers int
+	// Progress receives the progress bars, spinners and warnings shown
+	// while searching and downloading. os.Stderr is used when nil;
+	// io.Discard silences them.
+	Progress io.Writer
+
+	artworks artworkCache
+	// received counts the bytes downloaded, for progress output.
+	received atomic.Int64
+	// downloading counts the download progress bars shown, while which
+	// spinners are left out.
+	downloading atomic.Int32
+	// defaultFetcher is the RodFetcher used when Fetcher is nil, shared by
+	// every call until Close.
+	defaultFetcher     *RodFetcher
+	defaultFetcherOnce sync.Once
+	// defaultAPI is the APIClient used when API is nil, for the lists
+	// only the API can page through.
+	defaultAPI     *APIClient
+	defaultAPIOnce sync.Once
+}
+
+// DefaultTrackWorkers is the number of tracks downloaded at once when
+// Client.TrackWorkers is not set.
+const DefaultTrackWorkers = 3
+
+// DefaultSegmentWorkers is the number of segments fetched at once when
+// Client.SegmentWorkers is not set.
+const DefaultSegmentWorkers = 4
+
+// NewClient returns a Client with default settings. Close it when done,
+// to shut down the browser it launches on first use.
+func NewClient() *Client {
+	return &Client{}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) progress() io.Writer {
+	if c.Progress != nil {
+		return c.Progress
+	}
+	return os.Stderr
+}
+
+// api returns the client's API, or an APIClient sharing the client's HTTP
+// client, retry policy and limiter.
+func (c *Client) api() *APIClient {
+	if c.API != nil {
+		return c.API
+	}
+	c.defaultAPIOnce.Do(func() {
+		c.defaultAPI = NewAPIClient()
+		c.defaultAPI.HTTPClient = c.HTTPClient
+		c.defaultAPI.Retry = c.Retry
+		c.defaultAPI.Limiter = c.Limiter
+	})
+	return c.defaultAPI
+}
+
+func (c *Client) fetcher() Fetcher {
+	if c.Fetcher != nil {
+		return c.Fetcher
+	}
+	c.defaultFetcherOnce.Do(func() {
+		c.defaultFetcher = &RodFetcher{HTTPClient: c.HTTPClient}
+	})
+	return c.defaultFetcher
+}
+
+// Close releases the browser the client launched for itself. A Fetcher set
+// by the caller is left open for the caller to close.
+func (c *Client) Close() error {
+	c.defaultFetcherOnce.Do(func() {})
+	if c.defaultFetcher == nil {
+		return nil
+	}
+	return c.defaultFetcher.Close()
+}
+
+func (c *Client) trackWorkers() int {
+	if c.TrackWorkers > 0 {
+		return c.TrackWorkers
+	}
+	return DefaultTrackWorkers
+}
+
+func (c *Client) segmentWorkers() int {
+	if c.SegmentWorkers > 0 {
+		return c.SegmentWorkers
+	}
+	return DefaultSegmentWorkers
+}
+
+// openPage loads url through the fetcher, retrying failed loads.
+func (c *Client) openPage(ctx context.Context, url string) (Page, error) {
+	var page Page
+	err := c.Retry.do(ctx, func() error {
+		release, err := c.Limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		page, err = c.fetcher().Open(ctx, url)
+		release()
+		return fetcherError(err)
+	})
+	return page, err
+}
+
+// rateDescription returns a progress description that ends with the
+// current download rate, refreshed at most twice a second.
+func (c *Client) rateDescription(description string) func() string {
+	meter := newRateMeter(&c.received)
+	rendered := description
+	updated := time.Now()
+	return func() string {
+		if time.Since(updated) >= 500*time.Millisecond {
+			rendered = fmt.Sprintf("%s (%s)", description, formatRate(meter.sample()))
+			updated = time.Now()
+		}
+		return rendered
+	}
+}
@@ -1,17 +1,27 @@
 package scd
 
 import (
+	"time"
+
 	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
 )
 
+const cookieBannerTimeout = 10 * time.Second
+
 func acceptCookiesAndHandlePage(page *rod.Page) error {
-	err := rod.Try(func() {
-		page.MustWaitElementsMoreThan("#onetrust-accept-btn-handler", 0)
-		page.MustElement("#onetrust-accept-btn-handler").MustClick()
-		page.MustWait(`()=>document.querySelector(".onetrust-pc-dark-filter").style.display == "none"`)
-	})
+	page = page.Timeout(cookieBannerTimeout)
+	defer page.CancelTimeout()
+
+	btn, err := page.Element("#onetrust-accept-btn-handler")
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := btn.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return err
+	}
+	return page.Wait(rod.Eval(`() => {
+		const filter = document.querySelector(".onetrust-pc-dark-filter")
+		return !filter || filter.style.display == "none"
+	}`))
 }
@@ -6,4 +6,5 @@ const (
 	SoundCloudPlaylistSearchURL = "https://soundcloud.com/search/sets?q="
 	SoundCloudAlbumSearchURL    = "https://soundcloud.com/search/albums?q="
 	SoundCloudBaseURL           = "https://soundcloud.com"
+	SoundCloudAPIURL            = "https://api-v2.soundcloud.com"
 )
@@ -0,0 +1,326 @@
+package scd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// muxer turns the downloaded segments of a stream into an audio file.
+// writeChunk is called with every segment in order, the first one preceded
+// by the initialization section when the stream has one.
+type muxer interface {
+	// ext is the file extension of the output, without the dot.
+	ext() string
+	writeChunk(w io.Writer, data []byte) error
+	finish(w io.Writer) error
+}
+
+// newMuxer picks a muxer by inspecting the first chunk of a stream. codecs
+// is the CODECS attribute of the playlist, used when the data alone is not
+// conclusive. tags, when not nil, are written into the output.
+func newMuxer(first []byte, codecs string, tags *Tags) (muxer, error) {
+	audio := first[id3Length(first):]
+	switch {
+	case bytes.HasPrefix(first, []byte("OggS")):
+		if bytes.Contains(first[:min(len(first), 128)], []byte("OpusHead")) || strings.Contains(codecs, "opus") {
+			return &oggMuxer{tagger: &oggTagger{tags: tags}}, nil
+		}
+		return &passthroughMuxer{extension: "ogg"}, nil
+
+	case isMPEGTS(first):
+		demuxer := newTSDemuxer()
+		streamType, err := demuxer.probe(first)
+		if err != nil {
+			return nil, err
+		}
+		extension := "mp3"
+		if streamType == tsStreamADTS {
+			extension = "aac"
+		}
+		return &tsMuxer{demuxer: demuxer, extension: extension, tags: tags}, nil
+
+	case isMP4(first):
+		entry, payload, err := mp4SampleEntry(first)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read initialization section: %w", err)
+		}
+		switch entry {
+		case "mp4a":
+			return &mp4Muxer{extension: "m4a", tags: tags}, nil
+		case "Opus":
+			return newOpusMuxer(first, payload, tags)
+		default:
+			return &mp4Muxer{extension: "mp4", tags: tags}, nil
+		}
+
+	case isADTS(audio):
+		return &passthroughMuxer{extension: "aac", tags: tags}, nil
+
+	case len(audio) < len(first), isMPEGAudio(audio):
+		return &passthroughMuxer{extension: "mp3", tags: tags}, nil
+	}
+
+	switch {
+	case strings.Contains(codecs, "mp4a.40.34"), strings.Contains(codecs, "mp3"):
+		return &passthroughMuxer{extension: "mp3", tags: tags}, nil
+	case strings.Contains(codecs, "mp4a"):
+		return &passthroughMuxer{extension: "aac", tags: tags}, nil
+	}
+	return nil, errors.New("unrecognized stream format")
+}
+
+func isMP4(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	switch string(data[4:8]) {
+	case "ftyp", "moov", "styp":
+		return true
+	}
+	return false
+}
+
+func isADTS(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0xff && data[1]&0xf6 == 0xf0
+}
+
+// isMPEGAudio reports whether data starts with an MPEG audio frame header.
+func isMPEGAudio(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0 && data[1]&0x06 != 0
+}
+
+// passthroughMuxer writes the segments unchanged, for streams whose
+// segments already form a valid file when concatenated. Packed audio
+// segments start with an ID3 tag carrying their timestamp, which is
+// dropped so it does not end up in the middle of the file. When tags are
+// set they are written first as an ID3v2 tag.
+type passthroughMuxer struct {
+	extension string
+	tags      *Tags
+	started   bool
+}
+
+func (m *passthroughMuxer) ext() string {
+	return m.extension
+}
+
+func (m *passthroughMuxer) writeChunk(w io.Writer, data []byte) error {
+	if !m.started && m.tags != nil {
+		if _, err := w.Write(id3v2Tag(m.tags)); err != nil {
+			return err
+		}
+	}
+	m.started = true
+	_, err := w.Write(data[id3Length(data):])
+	return err
+}
+
+func (m *passthroughMuxer) finish(w io.Writer) error {
+	return nil
+}
+
+// tsMuxer writes the audio elementary stream carried in MPEG-TS segments,
+// preceded by an ID3v2 tag when tags are set.
+type tsMuxer struct {
+	demuxer   *tsDemuxer
+	extension string
+	tags      *Tags
+	started   bool
+}
+
+func (m *tsMuxer) ext() string {
+	return m.extension
+}
+
+func (m *tsMuxer) writeChunk(w io.Writer, data []byte) error {
+	if !m.started && m.tags != nil {
+		if _, err := w.Write(id3v2Tag(m.tags)); err != nil {
+			return err
+		}
+	}
+	m.started = true
+	return m.demuxer.write(w, data)
+}
+
+func (m *tsMuxer) finish(w io.Writer) error {
+	return nil
+}
+
+// mp4Muxer writes fragmented MP4 segments unchanged, adding iTunes
+// metadata to the initialization section when tags are set.
+type mp4Muxer struct {
+	extension string
+	tags      *Tags
+	started   bool
+}
+
+func (m *mp4Muxer) ext() string {
+	return m.extension
+}
+
+func (m *mp4Muxer) writeChunk(w io.Writer, data []byte) error {
+	if !m.started && m.tags != nil {
+		tagged, err := mp4WithMetadata(data, m.tags)
+		if err != nil {
+			return fmt.Errorf("cannot tag initialization section: %w", err)
+		}
+		data = tagged
+	}
+	m.started = true
+	_, err := w.Write(data)
+	return err
+}
+
+func (m *mp4Muxer) finish(w io.Writer) error {
+	return nil
+}
+
+// oggMuxer copies an Ogg Opus stream, replacing its comment header when
+// tags are set.
+type oggMuxer struct {
+	tagger *oggTagger
+}
+
+func (m *oggMuxer) ext() string {
+	return "opus"
+}
+
+func (m *oggMuxer) writeChunk(w io.Writer, data []byte) error {
+	if m.tagger.tags == nil {
+		_, err := w.Write(data)
+		return err
+	}
+	return m.tagger.write(w, data)
+}
+
+func (m *oggMuxer) finish(w io.Writer) error {
+	return m.tagger.finish()
+}
+
+// opusMuxer rewraps Opus packets from fragmented MP4 into Ogg.
+type opusMuxer struct {
+	ogg             *oggWriter
+	head            []byte
+	timescale       uint32
+	defaultDuration uint32
+	defaultSize     uint32
+	// position counts the samples written so far in timescale units.
+	position      uint64
+	headerWritten bool
+	tags          *Tags
+}
+
+func newOpusMuxer(init, sampleEntry []byte, tags *Tags) (*opusMuxer, error) {
+	// An audio sample entry has 28 bytes of fields before its child boxes.
+	if len(sampleEntry) < 28 {
+		return nil, errors.New("truncated Opus sample entry")
+	}
+	dOps, err := findMP4Box(sampleEntry[28:], "dOps")
+	if err != nil {
+		return nil, err
+	}
+	if dOps == nil || len(dOps.data) < 11 {
+		return nil, errors.New("missing Opus specific box")
+	}
+	timescale, err := mp4Timescale(init)
+	if err != nil {
+		return nil, err
+	}
+	if timescale == 0 {
+		return nil, errors.New("invalid timescale")
+	}
+	defaultDuration, defaultSize, err := mp4TrackDefaults(init)
+	if err != nil {
+		return nil, err
+	}
+
+	// dOps stores the OpusHead fields big-endian, without magic.
+	d := dOps.data
+	head := []byte("OpusHead")
+	head = append(head, 1, d[1])
+	head = binary.LittleEndian.AppendUint16(head, binary.BigEndian.Uint16(d[2:]))
+	head = binary.LittleEndian.AppendUint32(head, binary.BigEndian.Uint32(d[4:]))
+	head = binary.LittleEndian.AppendUint16(head, binary.BigEndian.Uint16(d[8:]))
+	head = append(head, d[10:]...)
+
+	return &opusMuxer{
+		ogg:             newOggWriter(0x5343_4430),
+		head:            head,
+		timescale:       timescale,
+		defaultDuration: defaultDuration,
+		defaultSize:     defaultSize,
+		tags:            tags,
+	}, nil
+}
+
+func (m *opusMuxer) ext() string {
+	return "opus"
+}
+
+func (m *opusMuxer) writeHeaders(w io.Writer) error {
+	if err := m.ogg.writeHeaderPacket(w, m.head); err != nil {
+		return err
+	}
+	comments := []string{}
+	if m.tags != nil {
+		comments = vorbisComments(m.tags)
+	}
+	return m.ogg.writeHeaderPacket(w, opusTags(comments))
+}
+
+func (m *opusMuxer) writeChunk(w io.Writer, data []byte) error {
+	if !m.headerWritten {
+		if err := m.writeHeaders(w); err != nil {
+			return err
+		}
+		m.headerWritten = true
+	}
+
+	boxes, err := readMP4Boxes(data)
+	if err != nil {
+		return err
+	}
+	for _, box := range boxes {
+		if box.kind != "moof" {
+			continue
+		}
+		samples, err := readMP4Fragment(data, box, m.defaultDuration, m.defaultSize)
+		if err != nil {
+			return err
+		}
+		for _, sample := range samples {
+			// Ogg Opus granule positions always count 48 kHz samples.
+			m.position += uint64(sample.duration)
+			granule := int64(m.position * 48000 / uint64(m.timescale))
+			if err := m.ogg.writePacket(w, sample.data, granule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *opusMuxer) finish(w io.Writer) error {
+	if !m.headerWritten {
+		return errors.New("no audio written")
+	}
+	return m.ogg.close(w)
+}
+
+// opusTags builds an OpusTags header packet with the given comments.
+func opusTags(comments []string) []byte {
+	vendor := "scd"
+	packet := []byte("OpusTags")
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(vendor)))
+	packet = append(packet, vendor...)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(comments)))
+	for _, comment := range comments {
+		packet = binary.LittleEndian.AppendUint32(packet, uint32(len(comment)))
+		packet = append(packet, comment...)
+	}
+	return packet
+}
@@ -0,0 +1,326 @@
+package scd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// adtsFrame is an ADTS header followed by a few bytes of payload.
+var adtsFrame = []byte{0xff, 0xf1, 0x50, 0x80, 0x02, 0x1f, 0xfc, 0xde, 0xad, 0xbe, 0xef}
+
+// timestampTag is the ID3 tag packed audio segments start with.
+func timestampTag(pts uint64) []byte {
+	frame := id3Frame("PRIV", binary.BigEndian.AppendUint64([]byte("com.apple.streaming.transportStreamTimestamp\x00"), pts))
+	return append(append([]byte("ID3"), 4, 0, 0), append(syncsafe(len(frame)), frame...)...)
+}
+
+func muxChunks(t *testing.T, chunks [][]byte, codecs string, tags *Tags) (muxer, []byte) {
+	t.Helper()
+	mux, err := newMuxer(chunks[0], codecs, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	for index, chunk := range chunks {
+		if err := mux.writeChunk(output, chunk); err != nil {
+			t.Fatalf("chunk %d: %v", index, err)
+		}
+	}
+	if err := mux.finish(output); err != nil {
+		t.Fatal(err)
+	}
+	return mux, output.Bytes()
+}
+
+func TestPackedAudio(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		ext    string
+		want   []byte
+	}{
+		{
+			name:   "AAC",
+			chunks: [][]byte{append(timestampTag(0), adtsFrame...), append(timestampTag(90000), adtsFrame...)},
+			ext:    "aac",
+			want:   append(bytes.Clone(adtsFrame), adtsFrame...),
+		},
+		{
+			name:   "MP3",
+			chunks: [][]byte{append(timestampTag(0), mp3Segment(0)...), append(timestampTag(90000), mp3Segment(1)...)},
+			ext:    "mp3",
+			want:   append(mp3Segment(0), mp3Segment(1)...),
+		},
+		{
+			name:   "without timestamps",
+			chunks: [][]byte{mp3Segment(0), mp3Segment(1)},
+			ext:    "mp3",
+			want:   append(mp3Segment(0), mp3Segment(1)...),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mux, output := muxChunks(t, test.chunks, "", nil)
+			if mux.ext() != test.ext {
+				t.Errorf("ext() = %s, want %s", mux.ext(), test.ext)
+			}
+			if !bytes.Equal(output, test.want) {
+				t.Errorf("output = %x, want %x", output, test.want)
+			}
+
+			// Only the tag of the file itself is left.
+			tags := &Tags{Title: "Title"}
+			_, output = muxChunks(t, test.chunks, "", tags)
+			if !bytes.Equal(output, append(id3v2Tag(tags), test.want...)) {
+				t.Errorf("tagged output = %x", output)
+			}
+		})
+	}
+}
+
+// tsPacket builds a transport stream packet, padding payload with an
+// adaptation field.
+func tsPacket(pid int, unitStart bool, payload []byte) []byte {
+	packet := []byte{0x47, byte(pid >> 8 & 0x1f), byte(pid), 0x10}
+	if unitStart {
+		packet[1] |= 0x40
+	}
+	if stuffing := 184 - len(payload); stuffing > 0 {
+		packet[3] = 0x30
+		packet = append(packet, byte(stuffing-1))
+		if stuffing > 1 {
+			packet = append(packet, 0)
+			packet = append(packet, bytes.Repeat([]byte{0xff}, stuffing-2)...)
+		}
+	}
+	return append(packet, payload...)
+}
+
+// tsTable builds the payload of a PSI table section, with a pointer field
+// and a dummy CRC.
+func tsTable(tableID byte, id uint16, body []byte) []byte {
+	length := 5 + len(body) + 4
+	section := []byte{0, tableID, 0xb0 | byte(length>>8), byte(length), byte(id >> 8), byte(id), 0xc1, 0, 0}
+	section = append(section, body...)
+	return append(section, 0, 0, 0, 0)
+}
+
+func TestTSDemux(t *testing.T) {
+	const pmtPID, audioPID = 0x100, 0x101
+	es := bytes.Repeat(adtsFrame, 30)
+	pes := append([]byte{0, 0, 1, 0xc0, 0, 0, 0x80, 0x80, 5, 0x21, 0, 1, 0, 1}, es...)
+
+	stream := tsPacket(0, true, tsTable(0x00, 1, []byte{0, 1, 0xe0 | pmtPID>>8, pmtPID & 0xff}))
+	stream = append(stream, tsPacket(pmtPID, true, tsTable(0x02, 1, []byte{
+		0xe0 | audioPID>>8, audioPID & 0xff, 0xf0, 0,
+		tsStreamADTS, 0xe0 | audioPID>>8, audioPID & 0xff, 0xf0, 0,
+	}))...)
+	stream = append(stream, tsPacket(audioPID, true, pes[:184])...)
+	// A packet of another stream in between is ignored.
+	stream = append(stream, tsPacket(0x200, true, []byte{0, 0, 1, 0xe0})...)
+	stream = append(stream, tsPacket(audioPID, false, pes[184:])...)
+
+	tags := &Tags{Title: "Title"}
+	mux, output := muxChunks(t, [][]byte{stream[:3*tsPacketSize], stream[3*tsPacketSize:]}, "", tags)
+	if mux.ext() != "aac" {
+		t.Errorf("ext() = %s, want aac", mux.ext())
+	}
+	if want := append(id3v2Tag(tags), es...); !bytes.Equal(output, want) {
+		t.Errorf("output = %x\nwant %x", output, want)
+	}
+
+	if err := newTSDemuxer().write(&bytes.Buffer{}, stream[:100]); err == nil {
+		t.Error("write() accepted a partial packet")
+	}
+}
+
+// fullBox returns the version and flags of a full box followed by fields.
+func fullBox(version byte, flags uint32, fields ...uint32) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(version)<<24|flags)
+	for _, field := range fields {
+		box = binary.BigEndian.AppendUint32(box, field)
+	}
+	return box
+}
+
+// mp4Init builds the initialization section of a fragmented MP4 stream
+// whose track has the given sample entry.
+func mp4Init(timescale uint32, sampleEntry []byte) []byte {
+	mdhd := mp4BoxBytes("mdhd", fullBox(0, 0, 0, 0, timescale, 0), []byte{0x55, 0xc4, 0, 0})
+	stsd := mp4BoxBytes("stsd", fullBox(0, 0, 1), sampleEntry)
+	stbl := mp4BoxBytes("stbl", stsd)
+	trak := mp4BoxBytes("trak", mp4BoxBytes("mdia", mdhd, mp4BoxBytes("minf", stbl)))
+	trex := mp4BoxBytes("trex", fullBox(0, 0, 1, 1, 0, 0, 0))
+	moov := mp4BoxBytes("moov", mp4BoxBytes("mvhd", make([]byte, 100)), trak, mp4BoxBytes("mvex", trex))
+	return append(mp4BoxBytes("ftyp", []byte("iso6"), make([]byte, 4), []byte("iso6mp41")), moov...)
+}
+
+// mp4Fragment builds a movie fragment holding samples of the given
+// duration.
+func mp4Fragment(sequence uint32, duration uint32, samples ...[]byte) []byte {
+	trunFields := []uint32{uint32(len(samples)), 0}
+	for _, sample := range samples {
+		trunFields = append(trunFields, duration, uint32(len(sample)))
+	}
+	build := func(dataOffset uint32) []byte {
+		trunFields[1] = dataOffset
+		trun := mp4BoxBytes("trun", fullBox(0, 0x301, trunFields...))
+		traf := mp4BoxBytes("traf", mp4BoxBytes("tfhd", fullBox(0, 0x020000, 1)), trun)
+		return mp4BoxBytes("moof", mp4BoxBytes("mfhd", fullBox(0, 0, sequence)), traf)
+	}
+	moof := build(0)
+	moof = build(uint32(len(moof) + 8))
+	return append(moof, mp4BoxBytes("mdat", samples...)...)
+}
+
+// audioSampleEntry builds an audio sample entry with the given child boxes.
+func audioSampleEntry(kind string, children ...[]byte) []byte {
+	fields := make([]byte, 28)
+	fields[7] = 1
+	fields[17] = 2
+	fields[19] = 16
+	binary.BigEndian.PutUint32(fields[24:], 48000<<16)
+	return mp4BoxBytes(kind, append([][]byte{fields}, children...)...)
+}
+
+func TestMP4Fragments(t *testing.T) {
+	init := mp4Init(44100, audioSampleEntry("mp4a"))
+	fragments := [][]byte{mp4Fragment(1, 1024, []byte("aac frame 1"), []byte("aac frame 2")), mp4Fragment(2, 1024, []byte("aac frame 3"))}
+	chunks := [][]byte{append(bytes.Clone(init), fragments[0]...), fragments[1]}
+
+	mux, output := muxChunks(t, chunks, "", nil)
+	if mux.ext() != "m4a" {
+		t.Errorf("ext() = %s, want m4a", mux.ext())
+	}
+	if !bytes.Equal(output, bytes.Join(chunks, nil)) {
+		t.Error("fragmented MP4 was not written unchanged")
+	}
+
+	boxes, err := readMP4Boxes(fragments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := readMP4Fragment(fragments[0], boxes[0], 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || string(samples[0].data) != "aac frame 1" || string(samples[1].data) != "aac frame 2" || samples[1].duration != 1024 {
+		t.Errorf("readMP4Fragment() = %+v", samples)
+	}
+}
+
+// readOggPages splits an Ogg stream into its pages, checking every CRC.
+func readOggPages(t *testing.T, data []byte) []*oggPage {
+	t.Helper()
+	pages := []*oggPage{}
+	for len(data) > 0 {
+		page, length, err := readOggPage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length == 0 {
+			t.Fatalf("truncated page after %d pages", len(pages))
+		}
+		encoded := bytes.Clone(data[:length])
+		stored := binary.LittleEndian.Uint32(encoded[22:])
+		binary.LittleEndian.PutUint32(encoded[22:], 0)
+		if crc := oggCRC(encoded); crc != stored {
+			t.Errorf("page %d has CRC %08x, want %08x", len(pages), stored, crc)
+		}
+		pages = append(pages, page)
+		data = data[length:]
+	}
+	return pages
+}
+
+func TestOggCRC(t *testing.T) {
+	// CRC-32 with polynomial 0x04c11db7, no reflection, zero initial value
+	// and no final xor.
+	if crc := oggCRC([]byte("123456789")); crc != 0x89a1897f {
+		t.Errorf("oggCRC() = %08x, want 89a1897f", crc)
+	}
+}
+
+func TestOggWriterPages(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer := newOggWriter(7)
+	if err := writer.writeHeaderPacket(output, []byte("OpusHead")); err != nil {
+		t.Fatal(err)
+	}
+	// A packet of 300 lacing values does not fit on one page.
+	large := bytes.Repeat([]byte{1}, 255*300)
+	if err := writer.writePacket(output, large, 960); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.writePacket(output, []byte("short"), 1920); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.close(output); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := readOggPages(t, output.Bytes())
+	want := []struct {
+		flags   byte
+		granule int64
+		lacing  int
+	}{
+		{oggBOS, 0, 1},
+		// The large packet fills a page without ending on it.
+		{0, -1, 255},
+		{oggContinued | oggEOS, 1920, 47},
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("wrote %d pages, want %d", len(pages), len(want))
+	}
+	body := []byte{}
+	for index, page := range pages {
+		if page.sequence != uint32(index) || page.serial != 7 {
+			t.Errorf("page %d has sequence %d and serial %d", index, page.sequence, page.serial)
+		}
+		if page.flags != want[index].flags || page.granule != want[index].granule || len(page.lacing) != want[index].lacing {
+			t.Errorf("page %d: flags %x, granule %d, %d lacing values, want %+v", index, page.flags, page.granule, len(page.lacing), want[index])
+		}
+		if index > 0 {
+			body = append(body, page.body...)
+		}
+	}
+	if !bytes.Equal(body, append(large, "short"...)) {
+		t.Error("packets were not split across pages in order")
+	}
+}
+
+func TestOpusFromMP4(t *testing.T) {
+	// dOps: version, channels, pre-skip, input sample rate, gain, mapping
+	// family.
+	dOps := mp4BoxBytes("dOps", []byte{0, 2, 0x01, 0x38, 0, 0, 0xbb, 0x80, 0, 0, 0})
+	init := mp4Init(48000, audioSampleEntry("Opus", dOps))
+	chunks := [][]byte{
+		append(init, mp4Fragment(1, 960, []byte{0xfc, 1}, []byte{0xfc, 2})...),
+		mp4Fragment(2, 960, []byte{0xfc, 3}),
+	}
+
+	mux, output := muxChunks(t, chunks, "", &Tags{Title: "Title"})
+	if mux.ext() != "opus" {
+		t.Errorf("ext() = %s, want opus", mux.ext())
+	}
+	pages := readOggPages(t, output)
+	if len(pages) != 3 {
+		t.Fatalf("wrote %d pages, want 3", len(pages))
+	}
+
+	head := []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	if !bytes.Equal(pages[0].body, head) || pages[0].flags != oggBOS {
+		t.Errorf("identification header = %x, flags %x", pages[0].body, pages[0].flags)
+	}
+	if !bytes.Equal(pages[1].body, opusTags([]string{"TITLE=Title"})) || pages[1].granule != 0 {
+		t.Errorf("comment header = %q", pages[1].body)
+	}
+	if !bytes.Equal(pages[2].body, []byte{0xfc, 1, 0xfc, 2, 0xfc, 3}) || !bytes.Equal(pages[2].lacing, []byte{2, 2, 2}) {
+		t.Errorf("audio page = %x with lacing %v", pages[2].body, pages[2].lacing)
+	}
+	if pages[2].granule != 3*960 || pages[2].flags != oggEOS {
+		t.Errorf("audio page granule %d, flags %x, want %d and end of stream", pages[2].granule, pages[2].flags, 3*960)
+	}
+}
@@ -0,0 +1,91 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// keyCache fetches each HLS key once per download.
+type keyCache struct {
+	client *Client
+	mutex  sync.Mutex
+	keys   map[string][]byte
+}
+
+func newKeyCache(client *Client) *keyCache {
+	return &keyCache{client: client, keys: map[string][]byte{}}
+}
+
+func (k *keyCache) get(ctx context.Context, uri string) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if key, ok := k.keys[uri]; ok {
+		return key, nil
+	}
+	key, err := k.client.fetchResource(ctx, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("key %s is %d bytes long, expected 16", uri, len(key))
+	}
+	k.keys[uri] = key
+	return key, nil
+}
+
+// segmentIV returns the IV from the key tag or, when it has none, the
+// media sequence number as a big-endian 128-bit integer.
+func segmentIV(key *HLSKey, sequence int64) []byte {
+	if key.IV != nil {
+		return key.IV
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	return iv
+}
+
+// decryptAES128 decrypts an AES-128-CBC resource and removes its PKCS#7
+// padding.
+func decryptAES128(data, key, iv []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data is %d bytes long, not a multiple of the block size", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("invalid padding, wrong key or IV")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// decrypt decrypts data of a segment or of its initialization
+// section according to the segment's key.
+func (k *keyCache) decrypt(ctx context.Context, segment *HLSSegment, data []byte) ([]byte, error) {
+	if segment.Key == nil {
+		return data, nil
+	}
+	if segment.Key.Method != "AES-128" {
+		return nil, fmt.Errorf("segments encrypted with %s are not supported", segment.Key.Method)
+	}
+	if segment.Key.URI == "" {
+		return nil, errors.New("AES-128 key without URI")
+	}
+	key, err := k.get(ctx, segment.Key.URI)
+	if err != nil {
+		return nil, err
+	}
+	return decryptAES128(data, key, segmentIV(segment.Key, segment.Sequence))
+}
@@ -0,0 +1,128 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	testKey   = []byte("0123456789abcdef")
+	testIV    = []byte("fedcba9876543210")
+	otherKey  = []byte("ffffffffffffffff")
+	testPlain = [][]byte{[]byte("first segment"), []byte("second segment, a bit longer than one block")}
+)
+
+// encryptAES128 pads data with PKCS#7 and encrypts it with AES-128-CBC.
+func encryptAES128(data, key, iv []byte) []byte {
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	plain := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+	return encrypted
+}
+
+func sequenceIV(sequence int64) []byte {
+	return segmentIV(&HLSKey{}, sequence)
+}
+
+func TestDownloadEncryptedSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		segments [][]byte
+		wantErr  string
+	}{
+		{
+			name: "explicit IV",
+			playlist: "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n" +
+				`#EXT-X-KEY:METHOD=AES-128,URI="/key",IV=0x` + hex.EncodeToString(testIV) + "\n" +
+				"#EXTINF:1,\n/seg/0\n#EXTINF:1,\n/seg/1\n#EXT-X-ENDLIST\n",
+			segments: [][]byte{encryptAES128(testPlain[0], testKey, testIV), encryptAES128(testPlain[1], testKey, testIV)},
+		},
+		{
+			name: "IV from media sequence",
+			playlist: "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n" +
+				`#EXT-X-KEY:METHOD=AES-128,URI="/key"` + "\n" +
+				"#EXTINF:1,\n/seg/0\n#EXTINF:1,\n/seg/1\n#EXT-X-ENDLIST\n",
+			segments: [][]byte{encryptAES128(testPlain[0], testKey, sequenceIV(7)), encryptAES128(testPlain[1], testKey, sequenceIV(8))},
+		},
+		{
+			name: "METHOD=NONE after a key",
+			playlist: "#EXTM3U\n" +
+				`#EXT-X-KEY:METHOD=AES-128,URI="/key"` + "\n#EXTINF:1,\n/seg/0\n" +
+				"#EXT-X-KEY:METHOD=NONE\n#EXTINF:1,\n/seg/1\n#EXT-X-ENDLIST\n",
+			segments: [][]byte{encryptAES128(testPlain[0], testKey, sequenceIV(0)), testPlain[1]},
+		},
+		{
+			name: "bad padding",
+			playlist: "#EXTM3U\n" +
+				`#EXT-X-KEY:METHOD=AES-128,URI="/key"` + "\n" +
+				"#EXTINF:1,\n/seg/0\n#EXTINF:1,\n/seg/1\n#EXT-X-ENDLIST\n",
+			segments: [][]byte{encryptAES128(testPlain[0], otherKey, sequenceIV(0)), encryptAES128(testPlain[1], otherKey, sequenceIV(1))},
+			wantErr:  "invalid padding",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyRequests := atomic.Int32{}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(test.playlist))
+			})
+			mux.HandleFunc("/key", func(w http.ResponseWriter, r *http.Request) {
+				keyRequests.Add(1)
+				w.Write(testKey)
+			})
+			mux.HandleFunc("/seg/0", func(w http.ResponseWriter, r *http.Request) { w.Write(test.segments[0]) })
+			mux.HandleFunc("/seg/1", func(w http.ResponseWriter, r *http.Request) { w.Write(test.segments[1]) })
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client := &Client{Retry: RetryPolicy{MaxAttempts: 1}}
+			ctx := context.Background()
+			playlist, err := client.loadHLSPlaylist(ctx, server.URL+"/playlist.m3u8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			written := [][]byte{}
+			err = client.downloadChunks(ctx, playlist.Segments, 0, func(index int, data []byte) error {
+				written = append(written, data)
+				return nil
+			})
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("downloadChunks() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for index, data := range written {
+				if !bytes.Equal(data, testPlain[index]) {
+					t.Errorf("segment %d = %q, want %q", index, data, testPlain[index])
+				}
+			}
+			if len(written) != len(testPlain) {
+				t.Errorf("wrote %d segments, want %d", len(written), len(testPlain))
+			}
+			if keyRequests.Load() != 1 {
+				t.Errorf("key fetched %d times, want once", keyRequests.Load())
+			}
+		})
+	}
+}
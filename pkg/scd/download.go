@@ -0,0 +1,250 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// fetchResource downloads uri, or only byteRange of it when it is set.
+// Temporary failures are retried according to the client's retry policy.
+func (c *Client) fetchResource(ctx context.Context, uri string, byteRange *HLSByteRange) ([]byte, error) {
+	var data []byte
+	err := c.Retry.do(ctx, func() error {
+		var err error
+		data, err = c.fetchResourceOnce(ctx, uri, byteRange)
+		return err
+	})
+	return data, err
+}
+
+func (c *Client) fetchResourceOnce(ctx context.Context, uri string, byteRange *HLSByteRange) ([]byte, error) {
+	release, err := c.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != nil {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", byteRange.Offset, byteRange.Offset+byteRange.Length-1))
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("failed to fetch %s: %w", uri, err)}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && byteRange != nil:
+	case resp.StatusCode == http.StatusOK:
+	default:
+		return nil, statusError(resp, fmt.Errorf("failed to fetch %s: unexpected status %s", uri, resp.Status))
+	}
+	data, err := io.ReadAll(&throttledReader{ctx: ctx, reader: resp.Body, limiter: c.Bandwidth, counter: &c.received})
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("failed to read bytes from the response: %w", err)}
+	}
+
+	// The server ignored the Range header and sent the whole resource.
+	if resp.StatusCode == http.StatusOK && byteRange != nil {
+		end := byteRange.Offset + byteRange.Length
+		if end > int64(len(data)) {
+			return nil, fmt.Errorf("byte range %d@%d is outside of %s", byteRange.Length, byteRange.Offset, uri)
+		}
+		data = data[byteRange.Offset:end]
+	}
+	return data, nil
+}
+
+// loadHLSPlaylist fetches and parses the playlist at playlistURL. A master
+// playlist is followed to its variant with the highest bandwidth.
+func (c *Client) loadHLSPlaylist(ctx context.Context, playlistURL string) (*HLSPlaylist, error) {
+	codecs := ""
+	for depth := 0; depth < 2; depth++ {
+		base, err := url.Parse(playlistURL)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.fetchResource(ctx, playlistURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		playlist, err := ParseHLSPlaylist(bytes.NewReader(body), base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid playlist %s: %w", playlistURL, err)
+		}
+		if !playlist.Master {
+			playlist.Codecs = codecs
+			return playlist, nil
+		}
+		if len(playlist.Variants) == 0 {
+			return nil, fmt.Errorf("master playlist %s has no variants", playlistURL)
+		}
+
+		best := playlist.Variants[0]
+		for _, variant := range playlist.Variants[1:] {
+			if variant.Bandwidth > best.Bandwidth {
+				best = variant
+			}
+		}
+		playlistURL = best.URI
+		codecs = best.Codecs
+	}
+	return nil, errors.New("nested master playlists")
+}
+
+// streamPlaylist looks up the HLS playlist of a track, through the API when
+// the client has one and through the fetcher otherwise, and loads it.
+func (c *Client) streamPlaylist(ctx context.Context, song *SongData) (*HLSPlaylist, error) {
+	if c.API != nil {
+		streamURL, mimeType, err := c.API.songStreamURL(ctx, song)
+		if err != nil {
+			return nil, err
+		}
+		playlist, err := c.loadHLSPlaylist(ctx, streamURL)
+		if err != nil {
+			return nil, err
+		}
+		playlist.MimeType = mimeType
+		return playlist, nil
+	}
+
+	var streamURL string
+	err := c.Retry.do(ctx, func() error {
+		release, err := c.Limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		streamURL, err = c.fetcher().StreamURL(ctx, song.Url)
+		release()
+		return fetcherError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.loadHLSPlaylist(ctx, streamURL)
+}
+
+// downloadChunk downloads and decrypts a segment, preceded by its
+// initialization section when it differs from the one of the previous
+// segment.
+func (c *Client) downloadChunk(ctx context.Context, keys *keyCache, segment, previous *HLSSegment) ([]byte, error) {
+	data := []byte{}
+	if segment.Map != nil && (previous == nil || previous.Map != segment.Map) {
+		init, err := c.fetchResource(ctx, segment.Map.URI, segment.Map.ByteRange)
+		if err != nil {
+			return nil, fmt.Errorf("initialization section: %w", err)
+		}
+		// An initialization section is only encrypted when the key tag
+		// carries an explicit IV for it.
+		if segment.Key != nil && segment.Key.IV != nil {
+			if init, err = keys.decrypt(ctx, segment, init); err != nil {
+				return nil, fmt.Errorf("initialization section: %w", err)
+			}
+		}
+		data = append(data, init...)
+	}
+
+	body, err := c.fetchResource(ctx, segment.URI, segment.ByteRange)
+	if err != nil {
+		return nil, err
+	}
+	body, err = keys.decrypt(ctx, segment, body)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, body...), nil
+}
+
+// downloadChunks downloads the segments from index start on and passes
+// them to write in playlist order as soon as they are available. At most
+// segmentWorkers segments are fetched at once, and a segment is only
+// fetched once fewer than twice that many are waiting to be written, so
+// memory use does not grow with the length of the track.
+func (c *Client) downloadChunks(ctx context.Context, segments []HLSSegment, start int, write func(index int, data []byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index int
+		data  []byte
+		err   error
+	}
+	workers := c.segmentWorkers()
+	jobs := make(chan int)
+	results := make(chan result)
+	// window holds a slot for every segment between being queued and being
+	// written.
+	window := make(chan struct{}, workers*2)
+	keys := newKeyCache(c)
+
+	go func() {
+		defer close(jobs)
+		for index := start; index < len(segments); index++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for index := range jobs {
+				var previous *HLSSegment
+				if index > 0 {
+					previous = &segments[index-1]
+				}
+				data, err := c.downloadChunk(ctx, keys, &segments[index], previous)
+				if err != nil {
+					err = fmt.Errorf("segment %d: %w", index, err)
+				}
+				select {
+				case results <- result{index: index, data: data, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Segments that arrive early wait here until their predecessors are
+	// written.
+	pending := map[int][]byte{}
+	next := start
+	for next < len(segments) {
+		var res result
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if res.err != nil {
+			return res.err
+		}
+		pending[res.index] = res.data
+		for data, ok := pending[next]; ok; data, ok = pending[next] {
+			delete(pending, next)
+			if err := write(next, data); err != nil {
+				return err
+			}
+			<-window
+			next++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package scd
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrElementNotFound is returned by Page and Element lookups when nothing
+// matches the selector.
+var ErrElementNotFound = errors.New("element not found")
+
+// ErrNoStream is returned by Fetcher.StreamURL when the track page never
+// requested an HLS playlist.
+var ErrNoStream = errors.New("no stream found")
+
+// Fetcher opens SoundCloud pages for scraping. The search and download
+// paths of Client only talk to pages through this interface, so the
+// selectors can be run against a real browser (RodFetcher) or saved HTML
+// (StaticFetcher).
+type Fetcher interface {
+	// Open loads url and returns the page once it is ready to be queried.
+	Open(ctx context.Context, url string) (Page, error)
+	// StreamURL loads the track page at url and returns the url of the HLS
+	// playlist its player requests.
+	StreamURL(ctx context.Context, url string) (string, error)
+}
+
+// Page is a loaded document.
+type Page interface {
+	// Element returns the first element matching selector, or
+	// ErrElementNotFound.
+	Element(selector string) (Element, error)
+	// Elements returns every element matching selector.
+	Elements(selector string) ([]Element, error)
+	// WaitElement waits until at least one of the selectors matches.
+	WaitElement(selectors ...string) error
+	// ScrollUntil scrolls the page until count elements match selector.
+	ScrollUntil(selector string, count int) error
+	// Hydration returns the window.__sc_hydration data of the page as
+	// JSON, or ErrNoHydration.
+	Hydration() ([]byte, error)
+	// Close releases the page.
+	Close() error
+}
+
+// Element is a node of a Page.
+type Element interface {
+	// Element returns the first child matching selector, or
+	// ErrElementNotFound.
+	Element(selector string) (Element, error)
+	// Elements returns every child matching selector.
+	Elements(selector string) ([]Element, error)
+	// Text returns the text content of the element.
+	Text() (string, error)
+	// Attribute returns the value of the attribute and whether it is set.
+	Attribute(name string) (string, bool, error)
+	// Expand clicks the child matching selector and waits until its text
+	// changes, for "show more" style links. Elements that cannot be
+	// interacted with return nil.
+	Expand(selector string) error
+}
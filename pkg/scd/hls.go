@@ -0,0 +1,321 @@
+package scd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HLSPlaylist is a parsed m3u8 playlist. A master playlist only has
+// Variants, a media playlist only has Segments.
+type HLSPlaylist struct {
+	Master         bool
+	Version        int
+	TargetDuration float64
+	MediaSequence  int64
+	EndList        bool
+	// Codecs is the CODECS attribute of the variant a media playlist was
+	// picked from, if any.
+	Codecs string
+	// MimeType is the mime type of the stream when the API reported it.
+	MimeType string
+	Variants []HLSVariant
+	Segments []HLSSegment
+}
+
+// HLSVariant is an #EXT-X-STREAM-INF entry of a master playlist.
+type HLSVariant struct {
+	URI       string
+	Bandwidth int
+	Codecs    string
+}
+
+// HLSSegment is a media segment with the tags that apply to it.
+type HLSSegment struct {
+	URI           string
+	Duration      float64
+	Title         string
+	Sequence      int64
+	ByteRange     *HLSByteRange
+	Key           *HLSKey
+	Map           *HLSMap
+	Discontinuity bool
+}
+
+// HLSByteRange is a sub-range of a resource, from #EXT-X-BYTERANGE or the
+// BYTERANGE attribute of #EXT-X-MAP.
+type HLSByteRange struct {
+	Length int64
+	Offset int64
+}
+
+// HLSKey describes how the segments following an #EXT-X-KEY tag are
+// encrypted. IV is nil when the tag has no IV attribute.
+type HLSKey struct {
+	Method    string
+	URI       string
+	IV        []byte
+	KeyFormat string
+}
+
+// HLSMap is the initialization section from #EXT-X-MAP.
+type HLSMap struct {
+	URI       string
+	ByteRange *HLSByteRange
+}
+
+// Duration returns the summed EXTINF duration of the segments in seconds.
+func (p *HLSPlaylist) Duration() float64 {
+	total := 0.0
+	for _, segment := range p.Segments {
+		total += segment.Duration
+	}
+	return total
+}
+
+// ParseHLSPlaylist parses an m3u8 playlist. Relative URIs are resolved
+// against base, which may be nil when all URIs are absolute.
+func ParseHLSPlaylist(r io.Reader, base *url.URL) (*HLSPlaylist, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	playlist := &HLSPlaylist{}
+	resolve := func(ref string) (string, error) {
+		if base == nil {
+			return ref, nil
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return "", fmt.Errorf("invalid uri %q: %w", ref, err)
+		}
+		return u.String(), nil
+	}
+
+	var (
+		segment       HLSSegment
+		variant       *HLSVariant
+		key           *HLSKey
+		initSection   *HLSMap
+		lastRangeEnd  = map[string]int64{}
+		pendingRange  *HLSByteRange
+		sequence      int64
+		sequenceSet   bool
+		headerChecked bool
+	)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !headerChecked {
+			if line != "#EXTM3U" {
+				return nil, errors.New("missing #EXTM3U header")
+			}
+			headerChecked = true
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			uri, err := resolve(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if variant != nil {
+				variant.URI = uri
+				playlist.Variants = append(playlist.Variants, *variant)
+				variant = nil
+				continue
+			}
+
+			if !sequenceSet {
+				sequence = playlist.MediaSequence
+				sequenceSet = true
+			}
+			segment.URI = uri
+			segment.Sequence = sequence
+			segment.Key = key
+			segment.Map = initSection
+			if pendingRange != nil {
+				if pendingRange.Offset < 0 {
+					pendingRange.Offset = lastRangeEnd[uri]
+				}
+				lastRangeEnd[uri] = pendingRange.Offset + pendingRange.Length
+				segment.ByteRange = pendingRange
+				pendingRange = nil
+			}
+			playlist.Segments = append(playlist.Segments, segment)
+			segment = HLSSegment{}
+			sequence++
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-VERSION":
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid version: %w", lineNumber, err)
+			}
+			playlist.Version = v
+		case "#EXT-X-TARGETDURATION":
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid target duration: %w", lineNumber, err)
+			}
+			playlist.TargetDuration = d
+		case "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid media sequence: %w", lineNumber, err)
+			}
+			playlist.MediaSequence = n
+		case "#EXT-X-ENDLIST":
+			playlist.EndList = true
+		case "#EXT-X-DISCONTINUITY":
+			segment.Discontinuity = true
+		case "#EXTINF":
+			duration, title, _ := strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(strings.TrimSpace(duration), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid segment duration: %w", lineNumber, err)
+			}
+			segment.Duration = d
+			segment.Title = title
+		case "#EXT-X-BYTERANGE":
+			r, err := parseByteRange(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			pendingRange = r
+		case "#EXT-X-KEY":
+			attrs, err := parseAttributeList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			key, err = parseKey(attrs, resolve)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		case "#EXT-X-MAP":
+			attrs, err := parseAttributeList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			uri, err := resolve(attrs["URI"])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			initSection = &HLSMap{URI: uri}
+			if attrs["BYTERANGE"] != "" {
+				r, err := parseByteRange(attrs["BYTERANGE"])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				if r.Offset < 0 {
+					r.Offset = 0
+				}
+				initSection.ByteRange = r
+			}
+		case "#EXT-X-STREAM-INF":
+			attrs, err := parseAttributeList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			playlist.Master = true
+			variant = &HLSVariant{Codecs: attrs["CODECS"]}
+			if attrs["BANDWIDTH"] != "" {
+				variant.Bandwidth, err = strconv.Atoi(attrs["BANDWIDTH"])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid bandwidth: %w", lineNumber, err)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !headerChecked {
+		return nil, errors.New("empty playlist")
+	}
+	return playlist, nil
+}
+
+// parseByteRange parses "<n>[@<o>]". A missing offset is reported as -1.
+func parseByteRange(value string) (*HLSByteRange, error) {
+	length, offset, hasOffset := strings.Cut(value, "@")
+	r := &HLSByteRange{Offset: -1}
+	var err error
+	if r.Length, err = strconv.ParseInt(length, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid byte range %q: %w", value, err)
+	}
+	if hasOffset {
+		if r.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid byte range %q: %w", value, err)
+		}
+	}
+	return r, nil
+}
+
+func parseKey(attrs map[string]string, resolve func(string) (string, error)) (*HLSKey, error) {
+	key := &HLSKey{Method: attrs["METHOD"], KeyFormat: attrs["KEYFORMAT"]}
+	if key.Method == "" {
+		return nil, errors.New("key without METHOD")
+	}
+	if key.Method == "NONE" {
+		return nil, nil
+	}
+	if attrs["URI"] != "" {
+		uri, err := resolve(attrs["URI"])
+		if err != nil {
+			return nil, err
+		}
+		key.URI = uri
+	}
+	if iv := attrs["IV"]; iv != "" {
+		if !strings.HasPrefix(iv, "0x") && !strings.HasPrefix(iv, "0X") {
+			return nil, fmt.Errorf("invalid IV %q", iv)
+		}
+		decoded, err := hex.DecodeString(iv[2:])
+		if err != nil || len(decoded) > 16 {
+			return nil, fmt.Errorf("invalid IV %q", iv)
+		}
+		key.IV = make([]byte, 16)
+		copy(key.IV[16-len(decoded):], decoded)
+	}
+	return key, nil
+}
+
+// parseAttributeList parses a comma separated list of NAME=VALUE pairs
+// where values may be quoted strings containing commas.
+func parseAttributeList(value string) (map[string]string, error) {
+	attrs := map[string]string{}
+	for len(value) > 0 {
+		name, rest, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid attribute list %q", value)
+		}
+		name = strings.TrimSpace(name)
+
+		var attr string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted string in %q", value)
+			}
+			attr = rest[1 : end+1]
+			rest = rest[end+2:]
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			attr, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[name] = attr
+		value = rest
+	}
+	return attrs, nil
+}
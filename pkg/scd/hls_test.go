@@ -0,0 +1,135 @@
+package scd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHLSPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example/media/track/playlist.m3u8?Policy=abc")
+	input := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:6",
+		"#EXT-X-TARGETDURATION:10",
+		"#EXT-X-MEDIA-SEQUENCE:5",
+		`#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"`,
+		`#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example/key?id=1,2",IV=0x1f`,
+		"#EXTINF:9.5,first",
+		"#EXT-X-BYTERANGE:1000@720",
+		"media.mp4",
+		"",
+		"#EXTINF:10,",
+		"#EXT-X-BYTERANGE:2000",
+		"media.mp4",
+		"#EXT-X-KEY:METHOD=NONE",
+		"#EXT-X-DISCONTINUITY",
+		"#EXTINF:3.25,",
+		"/other/segment.mp4?token=x",
+		"#EXT-X-ENDLIST",
+	}, "\n")
+
+	playlist, err := ParseHLSPlaylist(strings.NewReader(input), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Master || playlist.Version != 6 || playlist.TargetDuration != 10 || playlist.MediaSequence != 5 || !playlist.EndList {
+		t.Errorf("header = %+v", playlist)
+	}
+	if playlist.Duration() != 22.75 {
+		t.Errorf("Duration() = %v, want 22.75", playlist.Duration())
+	}
+
+	initSection := &HLSMap{URI: "https://cdn.example/media/track/init.mp4", ByteRange: &HLSByteRange{Length: 720, Offset: 0}}
+	iv := make([]byte, 16)
+	iv[15] = 0x1f
+	key := &HLSKey{Method: "AES-128", URI: "https://keys.example/key?id=1,2", IV: iv}
+	want := []HLSSegment{
+		{URI: "https://cdn.example/media/track/media.mp4", Duration: 9.5, Title: "first", Sequence: 5, ByteRange: &HLSByteRange{Length: 1000, Offset: 720}, Key: key, Map: initSection},
+		// A range without an offset continues where the previous range of
+		// the same resource ended.
+		{URI: "https://cdn.example/media/track/media.mp4", Duration: 10, Sequence: 6, ByteRange: &HLSByteRange{Length: 2000, Offset: 1720}, Key: key, Map: initSection},
+		{URI: "https://cdn.example/other/segment.mp4?token=x", Duration: 3.25, Sequence: 7, Map: initSection, Discontinuity: true},
+	}
+	if len(playlist.Segments) != len(want) {
+		t.Fatalf("parsed %d segments, want %d", len(playlist.Segments), len(want))
+	}
+	for index := range want {
+		if !reflect.DeepEqual(playlist.Segments[index], want[index]) {
+			t.Errorf("segment %d =\n%+v\nwant\n%+v", index, playlist.Segments[index], want[index])
+		}
+	}
+	if playlist.Segments[0].Map != playlist.Segments[2].Map {
+		t.Error("segments under the same EXT-X-MAP do not share it")
+	}
+}
+
+func TestParseHLSMasterPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example/master.m3u8")
+	input := "#EXTM3U\n" +
+		`#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="opus"` + "\nlow/playlist.m3u8\n" +
+		`#EXT-X-STREAM-INF:CODECS="mp4a.40.2,avc1.4d401e",BANDWIDTH=160000,NAME="a, b"` + "\nhttps://other.example/high.m3u8\n"
+
+	playlist, err := ParseHLSPlaylist(strings.NewReader(input), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HLSVariant{
+		{URI: "https://cdn.example/low/playlist.m3u8", Bandwidth: 64000, Codecs: "opus"},
+		{URI: "https://other.example/high.m3u8", Bandwidth: 160000, Codecs: "mp4a.40.2,avc1.4d401e"},
+	}
+	if !playlist.Master || !reflect.DeepEqual(playlist.Variants, want) {
+		t.Errorf("variants = %+v, want %+v", playlist.Variants, want)
+	}
+}
+
+func TestParseHLSPlaylistErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"missing header", "#EXTINF:1,\nsegment.ts\n"},
+		{"invalid duration", "#EXTM3U\n#EXTINF:abc,\nsegment.ts\n"},
+		{"invalid byte range", "#EXTM3U\n#EXT-X-BYTERANGE:10@x\nsegment.ts\n"},
+		{"key without method", "#EXTM3U\n#EXT-X-KEY:URI=\"key\"\n"},
+		{"invalid IV", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key\",IV=1234\n"},
+		{"unterminated quote", "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseHLSPlaylist(strings.NewReader(test.input), nil); err == nil {
+				t.Error("ParseHLSPlaylist() succeeded")
+			}
+		})
+	}
+}
+
+func TestLoadHLSPlaylistVariant(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n"+
+			`#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.5"`+"\nlow.m3u8\n"+
+			`#EXT-X-STREAM-INF:BANDWIDTH=256000,CODECS="mp4a.40.2"`+"\nhigh.m3u8\n"+
+			`#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS="mp4a.40.2"`+"\nmid.m3u8\n")
+	})
+	mux.HandleFunc("/high.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXTINF:10,\nhigh/0.aac\n#EXT-X-ENDLIST\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{Retry: RetryPolicy{MaxAttempts: 1}}
+	playlist, err := client.loadHLSPlaylist(context.Background(), server.URL+"/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Codecs != "mp4a.40.2" || len(playlist.Segments) != 1 || playlist.Segments[0].URI != server.URL+"/high/0.aac" {
+		t.Errorf("loadHLSPlaylist() = %+v, want the highest bandwidth variant", playlist)
+	}
+}
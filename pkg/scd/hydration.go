@@ -0,0 +1,142 @@
+package scd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoHydration is returned when a page does not embed the
+// window.__sc_hydration data.
+var ErrNoHydration = errors.New("page has no hydration data")
+
+// hydrationMarker precedes the hydration data in the page source.
+const hydrationMarker = "window.__sc_hydration"
+
+// Hydration is the data SoundCloud embeds in its track, playlist, album
+// and user pages as window.__sc_hydration. Search pages load their results
+// later and only hydrate the signed in user.
+type Hydration struct {
+	// Track is set on track pages.
+	Track *SongData
+	// Playlist or Album is set on playlist and album pages, with the
+	// tracks the page embeds in full in Tracks. Pages of long sets only
+	// reference their later tracks by id, in which case Tracks is shorter
+	// than TrackCount.
+	Playlist *PlaylistData
+	Album    *AlbumData
+	Tracks   []SongData
+	// User is set on user pages.
+	User *UserData
+
+	sound *apiTrack
+	set   *apiPlaylist
+	user  *apiUser
+}
+
+type hydrationEntry struct {
+	Hydratable string          `json:"hydratable"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// ParseHydration reads the hydration data from the source of a page.
+func ParseHydration(html []byte) (*Hydration, error) {
+	data, err := extractHydration(html)
+	if err != nil {
+		return nil, err
+	}
+	return parseHydrationJSON(data)
+}
+
+// extractHydration returns the JSON array assigned to
+// window.__sc_hydration in the source of a page.
+func extractHydration(html []byte) ([]byte, error) {
+	start := bytes.Index(html, []byte(hydrationMarker))
+	if start < 0 {
+		return nil, ErrNoHydration
+	}
+	rest := html[start+len(hydrationMarker):]
+	equals := bytes.IndexByte(rest, '=')
+	if equals < 0 {
+		return nil, ErrNoHydration
+	}
+	// The decoder stops after the array, ignoring the rest of the script.
+	var data json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(rest[equals+1:])).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid hydration data: %w", err)
+	}
+	return data, nil
+}
+
+// parseHydrationJSON reads hydration data serialized on its own, as
+// returned by Page.Hydration.
+func parseHydrationJSON(data []byte) (*Hydration, error) {
+	entries := []hydrationEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid hydration data: %w", err)
+	}
+	return newHydration(entries)
+}
+
+func newHydration(entries []hydrationEntry) (*Hydration, error) {
+	h := &Hydration{}
+	for _, entry := range entries {
+		var err error
+		switch entry.Hydratable {
+		case "sound":
+			h.sound = &apiTrack{}
+			err = json.Unmarshal(entry.Data, h.sound)
+		case "playlist":
+			h.set = &apiPlaylist{}
+			err = json.Unmarshal(entry.Data, h.set)
+		case "user":
+			h.user = &apiUser{}
+			err = json.Unmarshal(entry.Data, h.user)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s hydration: %w", entry.Hydratable, err)
+		}
+	}
+
+	if h.sound != nil {
+		song := h.sound.songData()
+		h.Track = &song
+	}
+	if h.set != nil {
+		for _, track := range h.set.completeTracks() {
+			h.Tracks = append(h.Tracks, track.songData())
+		}
+		if h.set.IsAlbum {
+			h.Album = &AlbumData{Title: h.set.Title, Author: h.set.User.Username, Url: h.set.PermalinkURL, TrackCount: h.set.TrackCount, ArtworkURL: h.set.ArtworkURL}
+		} else {
+			h.Playlist = &PlaylistData{Title: h.set.Title, Author: h.set.User.Username, Url: h.set.PermalinkURL, TrackCount: h.set.TrackCount, ArtworkURL: h.set.ArtworkURL}
+		}
+	}
+	// Track and set pages hydrate their author too.
+	if h.user != nil && h.sound == nil && h.set == nil {
+		h.User = &UserData{ID: h.user.ID, Username: h.user.Username, Url: h.user.PermalinkURL}
+	}
+	return h, nil
+}
+
+// completeTracks returns the tracks of the set embedded in full, skipping
+// those only referenced by id.
+func (p *apiPlaylist) completeTracks() []apiTrack {
+	output := []apiTrack{}
+	for _, track := range p.Tracks {
+		if track.Title != "" {
+			output = append(output, track)
+		}
+	}
+	return output
+}
+
+// pageHydration returns the hydration data of a loaded page.
+func pageHydration(page Page) (*Hydration, error) {
+	data, err := page.Hydration()
+	if err != nil {
+		return nil, err
+	}
+	return parseHydrationJSON(data)
+}
@@ -0,0 +1,77 @@
+package scd
+
+import (
+	"strconv"
+)
+
+// id3Length returns the length of the ID3v2 tags data starts with, or 0
+// when it starts with something else.
+func id3Length(data []byte) int {
+	length := 0
+	for len(data)-length >= 10 && string(data[length:length+3]) == "ID3" {
+		header := data[length:]
+		size := 10 + (int(header[6]&0x7f)<<21 | int(header[7]&0x7f)<<14 | int(header[8]&0x7f)<<7 | int(header[9]&0x7f))
+		if header[5]&0x10 != 0 {
+			// The tag has a footer.
+			size += 10
+		}
+		length = min(length+size, len(data))
+	}
+	return length
+}
+
+// syncsafe encodes n as a 28-bit ID3v2 synchsafe integer.
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+func id3Frame(id string, data []byte) []byte {
+	frame := append([]byte(id), syncsafe(len(data))...)
+	frame = append(frame, 0, 0)
+	return append(frame, data...)
+}
+
+// id3TextFrame builds a UTF-8 text information frame.
+func id3TextFrame(id, text string) []byte {
+	return id3Frame(id, append([]byte{0x03}, text...))
+}
+
+// trackNumberText formats a track number as "n" or "n/total".
+func trackNumberText(tags *Tags) string {
+	text := strconv.Itoa(tags.TrackNumber)
+	if tags.TrackTotal > 0 {
+		text += "/" + strconv.Itoa(tags.TrackTotal)
+	}
+	return text
+}
+
+// id3v2Tag builds an ID3v2.4 tag holding the set fields of tags.
+func id3v2Tag(tags *Tags) []byte {
+	frames := []byte{}
+	text := func(id, value string) {
+		if value != "" {
+			frames = append(frames, id3TextFrame(id, value)...)
+		}
+	}
+	text("TIT2", tags.Title)
+	text("TPE1", tags.Artist)
+	text("TALB", tags.Album)
+	text("TPE2", tags.AlbumArtist)
+	if tags.TrackNumber > 0 {
+		text("TRCK", trackNumberText(tags))
+	}
+	if tags.Year > 0 {
+		text("TDRC", strconv.Itoa(tags.Year))
+	}
+	text("TCON", tags.Genre)
+	if tags.URL != "" {
+		frames = append(frames, id3Frame("WOAS", []byte(tags.URL))...)
+	}
+	if tags.Artwork != nil {
+		frames = append(frames, id3PictureFrame(tags.Artwork)...)
+	}
+
+	header := append([]byte("ID3"), 4, 0, 0)
+	header = append(header, syncsafe(len(frames))...)
+	return append(header, frames...)
+}
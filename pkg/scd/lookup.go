@@ -0,0 +1,177 @@
+package scd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ErrUnsupportedURL is returned for urls that are not a track, playlist,
+// album or user page.
+var ErrUnsupportedURL = errors.New("not a SoundCloud track, playlist, album or user url")
+
+// ErrNeedsAPI is returned in browser mode for urls that only carry an id,
+// such as those of embedded players.
+var ErrNeedsAPI = errors.New("url can only be looked up with the API")
+
+// ErrNotAvailable is returned for tracks that cannot be streamed, such as
+// Go+ tracks and tracks blocked in the current country.
+var ErrNotAvailable = errors.New("track is not available")
+
+// ErrNothingToDownload is returned for playlists, albums and user
+// collections without any track.
+var ErrNothingToDownload = errors.New("nothing to download")
+
+// Lookup finds out whether a SoundCloud url is a track, playlist, album or
+// user page, and returns what it points to. Any link ResolveURL accepts
+// can be used.
+func (c *Client) Lookup(ctx context.Context, url string) (*Hydration, error) {
+	ref, err := c.ResolveURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if c.API != nil {
+		return c.API.lookup(ctx, ref)
+	}
+	if ref.ID != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNeedsAPI, url)
+	}
+	page, err := c.openPage(ctx, ref.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+	return pageHydration(page)
+}
+
+// apiObjects maps the kinds of urls carrying only an id to the endpoint
+// of their object.
+var apiObjects = map[URLKind]string{
+	URLTrack: "/tracks/",
+	URLSet:   "/playlists/",
+	URLUser:  "/users/",
+}
+
+// lookup resolves ref into the same data its page embeds. Refs that only
+// carry an id are read from the endpoint of their kind, with their secret
+// token.
+func (a *APIClient) lookup(ctx context.Context, ref *URLRef) (*Hydration, error) {
+	data := json.RawMessage{}
+	var err error
+	if endpoint, ok := apiObjects[ref.Kind]; ok && ref.ID != 0 {
+		query := url.Values{}
+		if ref.Secret != "" {
+			query.Set("secret_token", ref.Secret)
+		}
+		err = a.get(ctx, endpoint+strconv.FormatInt(ref.ID, 10), query, &data)
+	} else {
+		err = a.resolve(ctx, ref.URL, &data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	kind := struct {
+		Kind string `json:"kind"`
+	}{}
+	if err := json.Unmarshal(data, &kind); err != nil {
+		return nil, fmt.Errorf("invalid response for %s: %w", ref.URL, err)
+	}
+	hydratable := kind.Kind
+	if hydratable == "track" {
+		hydratable = "sound"
+	}
+	return newHydration([]hydrationEntry{{Hydratable: hydratable, Data: data}})
+}
+
+// DownloadURL downloads the track, playlist, album or user collection a
+// SoundCloud url points to. User pages download the client's
+// UserCollections.
+func (c *Client) DownloadURL(ctx context.Context, url string) error {
+	jobs, notAvailable, err := c.urlJobs(ctx, url)
+	if len(jobs) == 0 {
+		return err
+	}
+	return errors.Join(err, jobsError(ctx, jobs, c.downloadJobs(ctx, jobs, notAvailable)))
+}
+
+// urlJobs lists the tracks a url points to, with the number of tracks
+// left out as unavailable. A url without any track to download is an
+// error, so it does not pass for a successful download.
+func (c *Client) urlJobs(ctx context.Context, url string) ([]trackJob, int, error) {
+	jobs, notAvailable, err := c.lookupJobs(ctx, url)
+	if len(jobs) == 0 && err == nil {
+		err = emptyError(url, notAvailable)
+	}
+	return jobs, notAvailable, err
+}
+
+// emptyError is the error for a url that lists no track to download.
+func emptyError(url string, notAvailable int) error {
+	if notAvailable > 0 {
+		return fmt.Errorf("%w: none of the %d tracks of %s", ErrNotAvailable, notAvailable, url)
+	}
+	return fmt.Errorf("%w: %s has no tracks", ErrNothingToDownload, url)
+}
+
+func (c *Client) lookupJobs(ctx context.Context, url string) ([]trackJob, int, error) {
+	ref, err := c.ResolveURL(ctx, url)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ref.Kind == URLUser {
+		return c.userJobs(ctx, ref.URL, c.UserCollections...)
+	}
+	if collection, ok := urlCollections[ref.Kind]; ok {
+		return c.userJobs(ctx, ref.URL, collection)
+	}
+	stop := c.startSpinner("Looking up " + url)
+	resource, err := c.Lookup(ctx, ref.URL)
+	stop()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up %s: %w", url, err)
+	}
+
+	switch {
+	case resource.Track != nil:
+		if !resource.Track.Available {
+			return nil, 1, fmt.Errorf("%w: %s", ErrNotAvailable, url)
+		}
+		if resource.Track.Url == "" {
+			resource.Track.Url = ref.URL
+		}
+		if resource.Track.Secret == "" {
+			resource.Track.Secret = ref.Secret
+		}
+		return []trackJob{{song: *resource.Track}}, 0, nil
+	case resource.Album != nil:
+		set := c.lookupSet(albumSet(resource.Album), resource, ref)
+		return c.setJobs(ctx, set, c.setDir(resource.Album.Title, resource.Album.Author))
+	case resource.Playlist != nil:
+		set := c.lookupSet(playlistSet(resource.Playlist), resource, ref)
+		return c.setJobs(ctx, set, c.setDir(resource.Playlist.Title, resource.Playlist.Author))
+	case resource.User != nil:
+		return c.userJobs(ctx, resource.User.Url, c.UserCollections...)
+	}
+	return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedURL, url)
+}
+
+// lookupSet completes a set found by Lookup with what reading its tracks
+// again takes. The url of a private set lacks its secret, so the share
+// link is kept instead, and in API mode the set is read by id along with
+// its secret token.
+func (c *Client) lookupSet(set setInfo, resource *Hydration, ref *URLRef) setInfo {
+	if set.url == "" || (ref.Secret != "" && ref.ID == 0) {
+		set.url = ref.URL
+	}
+	set.secret = ref.Secret
+	if c.API != nil && resource.set != nil {
+		set.id = resource.set.ID
+		if set.secret == "" {
+			set.secret = resource.set.SecretToken
+		}
+	}
+	return set
+}
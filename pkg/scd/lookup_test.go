@@ -0,0 +1,131 @@
+package scd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDownloadURLNothingAvailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Both tracks are blocked in the current country.
+		fmt.Fprint(w, `{"kind":"playlist","id":40,"title":"Set","permalink_url":"https://soundcloud.com/artist/sets/set","track_count":2,
+			"user":{"username":"Artist"},"tracks":[{"id":1,"title":"One","policy":"BLOCK"},{"id":2,"title":"Two","policy":"BLOCK"}]}`)
+	}))
+	defer server.Close()
+	client := &Client{API: &APIClient{BaseURL: server.URL, ClientID: freshClientID}, OutputDir: t.TempDir()}
+
+	err := client.DownloadURL(context.Background(), "https://soundcloud.com/artist/sets/set")
+	if !errors.Is(err, ErrNotAvailable) {
+		t.Errorf("DownloadURL() error = %v, want ErrNotAvailable", err)
+	}
+}
+
+// mp3Frame is the start of an MPEG-1 Layer III frame, enough for the
+// stream to be saved as MP3.
+var mp3Frame = append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+
+// newSecretServer stands in for the API and the CDN of a private set,
+// whose tracks are private too.
+func newSecretServer(t *testing.T, secret string) *httptest.Server {
+	var server *httptest.Server
+	track := func(id int) map[string]any {
+		return map[string]any{
+			"kind": "track", "id": id, "title": fmt.Sprintf("Track %d", id), "permalink_url": fmt.Sprintf("https://soundcloud.com/artist/track-%d", id),
+			"secret_token": fmt.Sprintf("s-track%d", id), "duration": 1000, "user": map[string]any{"username": "Artist"},
+			"media": map[string]any{"transcodings": []map[string]any{
+				{"url": server.URL + "/media/" + fmt.Sprint(id), "format": map[string]any{"protocol": "hls", "mime_type": "audio/mpeg"}},
+			}},
+		}
+	}
+	mux := http.NewServeMux()
+	handleJSON := func(pattern string, body func(r *http.Request) any) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if v := body(r); v != nil {
+				json.NewEncoder(w).Encode(v)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		})
+	}
+	// The set is private: it is only found with its secret, and only its
+	// first track is embedded in full.
+	handleJSON("/resolve", func(r *http.Request) any {
+		switch r.URL.Query().Get("url") {
+		case "https://soundcloud.com/artist/track-3/s-track3":
+			return track(3)
+		case "https://soundcloud.com/artist/sets/private/" + secret:
+		default:
+			return nil
+		}
+		return map[string]any{"kind": "playlist", "id": 50, "title": "Private", "permalink_url": "https://soundcloud.com/artist/sets/private",
+			"secret_token": secret, "track_count": 2, "user": map[string]any{"username": "Artist"}, "tracks": []any{track(1), map[string]any{"id": 2}}}
+	})
+	handleJSON("/playlists/50", func(r *http.Request) any {
+		if r.URL.Query().Get("secret_token") != secret {
+			return nil
+		}
+		return map[string]any{"kind": "playlist", "id": 50, "title": "Private", "permalink_url": "https://soundcloud.com/artist/sets/private",
+			"secret_token": secret, "track_count": 2, "user": map[string]any{"username": "Artist"}, "tracks": []any{track(1), map[string]any{"id": 2}}}
+	})
+	handleJSON("/tracks", func(r *http.Request) any {
+		query := r.URL.Query()
+		if query.Get("ids") != "2" || query.Get("playlistId") != "50" || query.Get("playlistSecretToken") != secret {
+			return nil
+		}
+		return []any{track(2)}
+	})
+	handleJSON("/tracks/{id}", func(r *http.Request) any {
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		if r.URL.Query().Get("secret_token") != fmt.Sprintf("s-track%d", id) {
+			return nil
+		}
+		return track(id)
+	})
+	handleJSON("/media/{id}", func(r *http.Request) any {
+		return map[string]any{"url": server.URL + "/hls/" + r.PathValue("id")}
+	})
+	mux.HandleFunc("/hls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXTINF:1.0,\n/segment/%s\n#EXT-X-ENDLIST\n", r.PathValue("id"))
+	})
+	mux.HandleFunc("/segment/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(mp3Frame)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadURLSecretSet(t *testing.T) {
+	const secret = "s-Secret"
+	server := newSecretServer(t, secret)
+	dir := t.TempDir()
+	client := &Client{API: &APIClient{BaseURL: server.URL, ClientID: freshClientID, Retry: RetryPolicy{MaxAttempts: 1}}, OutputDir: dir, Retry: RetryPolicy{MaxAttempts: 1}}
+	if err := client.DownloadURL(context.Background(), "https://soundcloud.com/artist/sets/private/"+secret+"?si=abc"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Artist - Track 1.mp3", "Artist - Track 2.mp3"} {
+		if _, err := os.Stat(filepath.Join(dir, "Private - Artist", name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDownloadURLSecretTrack(t *testing.T) {
+	server := newSecretServer(t, "s-Secret")
+	dir := t.TempDir()
+	client := &Client{API: &APIClient{BaseURL: server.URL, ClientID: freshClientID, Retry: RetryPolicy{MaxAttempts: 1}}, OutputDir: dir, Retry: RetryPolicy{MaxAttempts: 1}}
+	if err := client.DownloadURL(context.Background(), "https://soundcloud.com/artist/track-3/s-track3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Artist - Track 3.mp3")); err != nil {
+		t.Error(err)
+	}
+}
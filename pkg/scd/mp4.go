@@ -0,0 +1,217 @@
+package scd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// mp4Box is an ISO BMFF box. data holds the payload after the header.
+type mp4Box struct {
+	kind   string
+	offset int
+	data   []byte
+}
+
+// readMP4Boxes splits buf into the boxes it contains.
+func readMP4Boxes(buf []byte) ([]mp4Box, error) {
+	boxes := []mp4Box{}
+	for offset := 0; offset < len(buf); {
+		if len(buf)-offset < 8 {
+			return nil, errors.New("truncated box header")
+		}
+		size := int(binary.BigEndian.Uint32(buf[offset:]))
+		kind := string(buf[offset+4 : offset+8])
+		header := 8
+		switch size {
+		case 0:
+			size = len(buf) - offset
+		case 1:
+			if len(buf)-offset < 16 {
+				return nil, errors.New("truncated box header")
+			}
+			size = int(binary.BigEndian.Uint64(buf[offset+8:]))
+			header = 16
+		}
+		if size < header || offset+size > len(buf) {
+			return nil, fmt.Errorf("invalid size %d of box %q", size, kind)
+		}
+		boxes = append(boxes, mp4Box{kind: kind, offset: offset, data: buf[offset+header : offset+size]})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// findMP4Box follows path through nested boxes and returns the first match.
+func findMP4Box(buf []byte, path ...string) (*mp4Box, error) {
+	boxes, err := readMP4Boxes(buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, box := range boxes {
+		if box.kind != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return &box, nil
+		}
+		return findMP4Box(box.data, path[1:]...)
+	}
+	return nil, nil
+}
+
+// mp4SampleEntry returns the type and payload of the first sample entry of
+// the first track of an initialization section.
+func mp4SampleEntry(init []byte) (string, []byte, error) {
+	stsd, err := findMP4Box(init, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+	if err != nil {
+		return "", nil, err
+	}
+	if stsd == nil || len(stsd.data) < 8 {
+		return "", nil, errors.New("no sample description")
+	}
+	entries, err := readMP4Boxes(stsd.data[8:])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) == 0 {
+		return "", nil, errors.New("empty sample description")
+	}
+	return entries[0].kind, entries[0].data, nil
+}
+
+// mp4Timescale returns the media timescale of the first track.
+func mp4Timescale(init []byte) (uint32, error) {
+	mdhd, err := findMP4Box(init, "moov", "trak", "mdia", "mdhd")
+	if err != nil {
+		return 0, err
+	}
+	if mdhd == nil || len(mdhd.data) < 4 {
+		return 0, errors.New("no media header")
+	}
+	if mdhd.data[0] == 1 {
+		if len(mdhd.data) < 24 {
+			return 0, errors.New("truncated media header")
+		}
+		return binary.BigEndian.Uint32(mdhd.data[20:]), nil
+	}
+	if len(mdhd.data) < 16 {
+		return 0, errors.New("truncated media header")
+	}
+	return binary.BigEndian.Uint32(mdhd.data[12:]), nil
+}
+
+// mp4TrackDefaults returns the default sample duration and size from trex.
+func mp4TrackDefaults(init []byte) (duration, size uint32, err error) {
+	trex, err := findMP4Box(init, "moov", "mvex", "trex")
+	if err != nil || trex == nil || len(trex.data) < 24 {
+		return 0, 0, err
+	}
+	return binary.BigEndian.Uint32(trex.data[12:]), binary.BigEndian.Uint32(trex.data[16:]), nil
+}
+
+// mp4Sample is a sample of a movie fragment.
+type mp4Sample struct {
+	duration uint32
+	data     []byte
+}
+
+// readMP4Fragment returns the samples of the first track fragment of moof,
+// reading their payload from buf, the buffer moof was read from.
+func readMP4Fragment(buf []byte, moof mp4Box, defaultDuration, defaultSize uint32) ([]mp4Sample, error) {
+	traf, err := findMP4Box(moof.data, "traf")
+	if err != nil {
+		return nil, err
+	}
+	if traf == nil {
+		return nil, errors.New("movie fragment without track fragment")
+	}
+	children, err := readMP4Boxes(traf.data)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []mp4Sample{}
+	base := moof.offset
+	for _, box := range children {
+		data := box.data
+		switch box.kind {
+		case "tfhd":
+			if len(data) < 8 {
+				return nil, errors.New("truncated tfhd")
+			}
+			flags := binary.BigEndian.Uint32(data) & 0xffffff
+			pos := 8
+			if flags&0x01 != 0 {
+				if len(data) < pos+8 {
+					return nil, errors.New("truncated tfhd")
+				}
+				base = int(binary.BigEndian.Uint64(data[pos:]))
+				pos += 8
+			}
+			if flags&0x02 != 0 {
+				pos += 4
+			}
+			if flags&0x08 != 0 {
+				if len(data) < pos+4 {
+					return nil, errors.New("truncated tfhd")
+				}
+				defaultDuration = binary.BigEndian.Uint32(data[pos:])
+				pos += 4
+			}
+			if flags&0x10 != 0 {
+				if len(data) < pos+4 {
+					return nil, errors.New("truncated tfhd")
+				}
+				defaultSize = binary.BigEndian.Uint32(data[pos:])
+			}
+		case "trun":
+			if len(data) < 8 {
+				return nil, errors.New("truncated trun")
+			}
+			flags := binary.BigEndian.Uint32(data) & 0xffffff
+			count := int(binary.BigEndian.Uint32(data[4:]))
+			pos := 8
+			offset := base
+			if flags&0x01 != 0 {
+				if len(data) < pos+4 {
+					return nil, errors.New("truncated trun")
+				}
+				offset = base + int(int32(binary.BigEndian.Uint32(data[pos:])))
+				pos += 4
+			}
+			if flags&0x04 != 0 {
+				pos += 4
+			}
+			for i := 0; i < count; i++ {
+				duration, size := defaultDuration, defaultSize
+				if flags&0x100 != 0 {
+					if len(data) < pos+4 {
+						return nil, errors.New("truncated trun")
+					}
+					duration = binary.BigEndian.Uint32(data[pos:])
+					pos += 4
+				}
+				if flags&0x200 != 0 {
+					if len(data) < pos+4 {
+						return nil, errors.New("truncated trun")
+					}
+					size = binary.BigEndian.Uint32(data[pos:])
+					pos += 4
+				}
+				if flags&0x400 != 0 {
+					pos += 4
+				}
+				if flags&0x800 != 0 {
+					pos += 4
+				}
+				if offset < 0 || offset+int(size) > len(buf) {
+					return nil, errors.New("sample outside of the fragment")
+				}
+				samples = append(samples, mp4Sample{duration: duration, data: buf[offset : offset+int(size)]})
+				offset += int(size)
+			}
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,177 @@
+package scd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const tsPacketSize = 188
+
+// MPEG-TS stream types of the audio codecs the demuxer can extract.
+const (
+	tsStreamMPEG1Audio = 0x03
+	tsStreamMPEG2Audio = 0x04
+	tsStreamADTS       = 0x0f
+)
+
+// tsDemuxer extracts the elementary stream of the first audio track of an
+// MPEG transport stream. The stream may be fed in several chunks as long as
+// each chunk holds whole packets.
+type tsDemuxer struct {
+	pmtPID     int
+	audioPID   int
+	streamType byte
+	// pesHeader buffers the start of a PES packet until its header is
+	// complete.
+	pesHeader []byte
+	inHeader  bool
+}
+
+func newTSDemuxer() *tsDemuxer {
+	return &tsDemuxer{pmtPID: -1, audioPID: -1}
+}
+
+// isMPEGTS reports whether data starts with transport stream packets.
+func isMPEGTS(data []byte) bool {
+	if len(data) < tsPacketSize*2 {
+		return len(data) >= tsPacketSize && data[0] == 0x47
+	}
+	return data[0] == 0x47 && data[tsPacketSize] == 0x47
+}
+
+// probe reads the program tables of data and returns the stream type of
+// the audio track.
+func (d *tsDemuxer) probe(data []byte) (byte, error) {
+	if err := d.demux(io.Discard, data, false); err != nil {
+		return 0, err
+	}
+	if d.audioPID < 0 {
+		return 0, errors.New("transport stream has no supported audio track")
+	}
+	return d.streamType, nil
+}
+
+// write demuxes data and writes the audio payload to w.
+func (d *tsDemuxer) write(w io.Writer, data []byte) error {
+	return d.demux(w, data, true)
+}
+
+func (d *tsDemuxer) demux(w io.Writer, data []byte, emit bool) error {
+	if len(data)%tsPacketSize != 0 {
+		return fmt.Errorf("transport stream of %d bytes is not made of whole packets", len(data))
+	}
+	for offset := 0; offset < len(data); offset += tsPacketSize {
+		packet := data[offset : offset+tsPacketSize]
+		if packet[0] != 0x47 {
+			return fmt.Errorf("lost sync at byte %d", offset)
+		}
+		unitStart := packet[1]&0x40 != 0
+		pid := int(packet[1]&0x1f)<<8 | int(packet[2])
+		adaptation := packet[3] >> 4 & 0x03
+
+		payload := packet[4:]
+		if adaptation == 0x02 {
+			continue
+		}
+		if adaptation == 0x03 {
+			length := int(payload[0])
+			if length+1 > len(payload) {
+				return fmt.Errorf("invalid adaptation field at byte %d", offset)
+			}
+			payload = payload[length+1:]
+		}
+
+		switch {
+		case pid == 0 && unitStart:
+			d.readPAT(payload)
+		case pid == d.pmtPID && unitStart:
+			d.readPMT(payload)
+		case pid == d.audioPID && emit:
+			if err := d.writePES(w, payload, unitStart); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tsSection returns the table section a payload starts, skipping the
+// pointer field.
+func tsSection(payload []byte) []byte {
+	if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+		return nil
+	}
+	section := payload[int(payload[0])+1:]
+	if len(section) < 3 {
+		return nil
+	}
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	if 3+length > len(section) || length < 9 {
+		return nil
+	}
+	// Drop the trailing CRC.
+	return section[:3+length-4]
+}
+
+func (d *tsDemuxer) readPAT(payload []byte) {
+	section := tsSection(payload)
+	if section == nil {
+		return
+	}
+	for i := 8; i+4 <= len(section); i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		if program != 0 {
+			d.pmtPID = int(section[i+2]&0x1f)<<8 | int(section[i+3])
+			return
+		}
+	}
+}
+
+func (d *tsDemuxer) readPMT(payload []byte) {
+	section := tsSection(payload)
+	if section == nil || len(section) < 12 {
+		return
+	}
+	infoLength := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + infoLength; i+5 <= len(section); {
+		streamType := section[i]
+		pid := int(section[i+1]&0x1f)<<8 | int(section[i+2])
+		esInfoLength := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		switch streamType {
+		case tsStreamMPEG1Audio, tsStreamMPEG2Audio, tsStreamADTS:
+			if d.audioPID < 0 {
+				d.audioPID = pid
+				d.streamType = streamType
+			}
+		}
+		i += 5 + esInfoLength
+	}
+}
+
+// writePES strips PES headers and writes the elementary stream payload.
+func (d *tsDemuxer) writePES(w io.Writer, payload []byte, unitStart bool) error {
+	if unitStart {
+		d.pesHeader = d.pesHeader[:0]
+		d.inHeader = true
+	}
+	if !d.inHeader {
+		_, err := w.Write(payload)
+		return err
+	}
+
+	d.pesHeader = append(d.pesHeader, payload...)
+	if len(d.pesHeader) < 9 {
+		return nil
+	}
+	if d.pesHeader[0] != 0 || d.pesHeader[1] != 0 || d.pesHeader[2] != 1 {
+		return errors.New("invalid PES start code")
+	}
+	headerLength := 9 + int(d.pesHeader[8])
+	if len(d.pesHeader) < headerLength {
+		return nil
+	}
+	d.inHeader = false
+	_, err := w.Write(d.pesHeader[headerLength:])
+	return err
+}
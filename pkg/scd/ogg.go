@@ -0,0 +1,188 @@
+package scd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	oggContinued = 0x01
+	oggBOS       = 0x02
+	oggEOS       = 0x04
+)
+
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggWriter writes a single logical Ogg bitstream, packing packets into
+// pages of at most 255 lacing values. Packets larger than a page continue
+// on the next one.
+type oggWriter struct {
+	serial   uint32
+	sequence uint32
+	started  bool
+
+	lacing    []byte
+	body      []byte
+	granule   int64
+	completed bool
+	continued bool
+}
+
+func newOggWriter(serial uint32) *oggWriter {
+	return &oggWriter{serial: serial}
+}
+
+// writePacket queues a packet ending at granule, flushing full pages to w.
+func (o *oggWriter) writePacket(w io.Writer, packet []byte, granule int64) error {
+	for {
+		if len(o.lacing) == 255 {
+			if err := o.flush(w, 0); err != nil {
+				return err
+			}
+		}
+		if len(packet) < 255 {
+			break
+		}
+		o.lacing = append(o.lacing, 255)
+		o.body = append(o.body, packet[:255]...)
+		packet = packet[255:]
+	}
+	o.lacing = append(o.lacing, byte(len(packet)))
+	o.body = append(o.body, packet...)
+	o.granule = granule
+	o.completed = true
+	return nil
+}
+
+// writeHeaderPacket writes packet on pages of its own, as required for the
+// Opus identification and comment headers.
+func (o *oggWriter) writeHeaderPacket(w io.Writer, packet []byte) error {
+	if err := o.flush(w, 0); err != nil {
+		return err
+	}
+	if err := o.writePacket(w, packet, 0); err != nil {
+		return err
+	}
+	return o.flush(w, 0)
+}
+
+// flush writes the queued packets as one page.
+func (o *oggWriter) flush(w io.Writer, flags byte) error {
+	if len(o.lacing) == 0 && flags&oggEOS == 0 {
+		return nil
+	}
+	if !o.started {
+		flags |= oggBOS
+		o.started = true
+	}
+	if o.continued {
+		flags |= oggContinued
+	}
+	granule := o.granule
+	if !o.completed {
+		granule = -1
+	}
+
+	page := oggPage{
+		flags:    flags,
+		granule:  granule,
+		serial:   o.serial,
+		sequence: o.sequence,
+		lacing:   o.lacing,
+		body:     o.body,
+	}
+	if _, err := w.Write(page.bytes()); err != nil {
+		return err
+	}
+
+	o.sequence++
+	o.continued = len(o.lacing) > 0 && o.lacing[len(o.lacing)-1] == 255
+	o.completed = false
+	o.lacing = o.lacing[:0]
+	o.body = o.body[:0]
+	return nil
+}
+
+// close writes the remaining packets on a final page marked end of stream.
+func (o *oggWriter) close(w io.Writer) error {
+	return o.flush(w, oggEOS)
+}
+
+// oggPage is a single page of an Ogg bitstream.
+type oggPage struct {
+	flags    byte
+	granule  int64
+	serial   uint32
+	sequence uint32
+	lacing   []byte
+	body     []byte
+}
+
+// bytes encodes the page and computes its checksum.
+func (p *oggPage) bytes() []byte {
+	page := make([]byte, 27, 27+len(p.lacing)+len(p.body))
+	copy(page, "OggS")
+	page[5] = p.flags
+	binary.LittleEndian.PutUint64(page[6:], uint64(p.granule))
+	binary.LittleEndian.PutUint32(page[14:], p.serial)
+	binary.LittleEndian.PutUint32(page[18:], p.sequence)
+	page[26] = byte(len(p.lacing))
+	page = append(append(page, p.lacing...), p.body...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+	return page
+}
+
+// readOggPage parses the page at the start of data. It returns the page
+// and its encoded length, or a zero length when data holds only part of a
+// page.
+func readOggPage(data []byte) (*oggPage, int, error) {
+	if len(data) < 27 {
+		return nil, 0, nil
+	}
+	if string(data[:4]) != "OggS" {
+		return nil, 0, errors.New("lost Ogg page sync")
+	}
+	headerLength := 27 + int(data[26])
+	if len(data) < headerLength {
+		return nil, 0, nil
+	}
+	lacing := data[27:headerLength]
+	bodyLength := 0
+	for _, value := range lacing {
+		bodyLength += int(value)
+	}
+	if len(data) < headerLength+bodyLength {
+		return nil, 0, nil
+	}
+	return &oggPage{
+		flags:    data[5],
+		granule:  int64(binary.LittleEndian.Uint64(data[6:])),
+		serial:   binary.LittleEndian.Uint32(data[14:]),
+		sequence: binary.LittleEndian.Uint32(data[18:]),
+		lacing:   lacing,
+		body:     data[headerLength : headerLength+bodyLength],
+	}, headerLength + bodyLength, nil
+}
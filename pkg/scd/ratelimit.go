@@ -0,0 +1,96 @@
+package scd
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces the requests sent to SoundCloud. It is a token bucket
+// refilled at a fixed number of requests per second, combined with a cap
+// on the number of requests in flight. One limiter is meant to be shared
+// by page loads, API calls and segment downloads. A nil *RateLimiter does
+// not limit anything.
+type RateLimiter struct {
+	rps   float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+
+	inFlight chan struct{}
+}
+
+// NewRateLimiter returns a limiter allowing rps requests per second, with
+// bursts of up to one second's worth, and at most maxInFlight requests at
+// once. Either limit is disabled when zero or negative.
+func NewRateLimiter(rps float64, maxInFlight int) *RateLimiter {
+	l := &RateLimiter{rps: rps, burst: math.Max(1, math.Floor(rps)), last: time.Now()}
+	l.tokens = l.burst
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// Acquire waits until a request may be sent. The returned function must be
+// called once the request is done.
+func (l *RateLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait takes a token from the bucket, sleeping until one is available.
+func (l *RateLimiter) wait(ctx context.Context) error {
+	if l.rps <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rps)
+	l.last = now
+	// Taking the token up front reserves a slot, so waiting requests are
+	// served in order.
+	l.tokens--
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rps * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
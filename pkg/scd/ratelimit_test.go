@@ -0,0 +1,142 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquireWithin reports whether l grants a request within timeout.
+func acquireWithin(t *testing.T, l *RateLimiter, timeout time.Duration) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	release, err := l.Acquire(ctx)
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		return false
+	}
+	release()
+	return true
+}
+
+// rewind moves the last refill of l back by elapsed, as if that much time
+// had passed.
+func rewind(l *RateLimiter, elapsed time.Duration) {
+	l.mutex.Lock()
+	l.last = l.last.Add(-elapsed)
+	l.mutex.Unlock()
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(10, 0)
+	for i := 0; i < 10; i++ {
+		if !acquireWithin(t, l, 20*time.Millisecond) {
+			t.Fatalf("request %d of the burst waited", i)
+		}
+	}
+	// The next token is a tenth of a second away.
+	if acquireWithin(t, l, 20*time.Millisecond) {
+		t.Fatal("request after the burst did not wait")
+	}
+	// The cancelled request gave its token back, so the wait is not longer
+	// for the next one.
+	start := time.Now()
+	if !acquireWithin(t, l, time.Second) {
+		t.Fatal("request after the burst was not granted")
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("request after the burst waited %v, want about 100ms", elapsed)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := NewRateLimiter(10, 0)
+	for i := 0; i < 10; i++ {
+		acquireWithin(t, l, time.Second)
+	}
+
+	rewind(l, 300*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if !acquireWithin(t, l, 20*time.Millisecond) {
+			t.Fatalf("request %d after refilling three tokens waited", i)
+		}
+	}
+	if acquireWithin(t, l, 20*time.Millisecond) {
+		t.Fatal("fourth request after refilling three tokens did not wait")
+	}
+
+	// The bucket never holds more than a burst.
+	rewind(l, time.Hour)
+	for i := 0; i < 10; i++ {
+		if !acquireWithin(t, l, 20*time.Millisecond) {
+			t.Fatalf("request %d of the refilled burst waited", i)
+		}
+	}
+	if acquireWithin(t, l, 20*time.Millisecond) {
+		t.Fatal("request beyond the burst did not wait")
+	}
+}
+
+func TestRateLimiterInFlight(t *testing.T) {
+	l := NewRateLimiter(0, 2)
+	first, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acquireWithin(t, l, 20*time.Millisecond) {
+		t.Fatal("third request in flight was granted")
+	}
+
+	granted := make(chan struct{})
+	go func() {
+		release, err := l.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		close(granted)
+	}()
+	first()
+	select {
+	case <-granted:
+	case <-time.After(time.Second):
+		t.Fatal("waiting request was not granted after a release")
+	}
+	second()
+}
+
+func TestRateLimiterCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := NewRateLimiter(0, 1)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire() error = %v, want context.Canceled", err)
+	}
+
+	// A request cancelled while waiting for a token frees its slot.
+	l = NewRateLimiter(1, 1)
+	acquireWithin(t, l, time.Second)
+	if acquireWithin(t, l, 20*time.Millisecond) {
+		t.Fatal("request after the burst did not wait")
+	}
+	if len(l.inFlight) != 0 {
+		t.Errorf("%d requests in flight after cancelling, want 0", len(l.inFlight))
+	}
+
+	var unlimited *RateLimiter
+	if !acquireWithin(t, unlimited, time.Millisecond) {
+		t.Error("a nil limiter waited")
+	}
+}
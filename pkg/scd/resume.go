@@ -0,0 +1,213 @@
+package scd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveName is the file in each output directory listing the tracks that
+// finished downloading, one "<url>\t<filename>" line per track.
+const archiveName = ".scd-archive"
+
+// downloadState is the checkpoint stored next to a partial download. The
+// partial file holds the first len(Lengths) segments, decrypted and
+// concatenated. Format identifies the stream they come from.
+type downloadState struct {
+	URL      string  `json:"url"`
+	Format   string  `json:"format"`
+	Segments int     `json:"segments"`
+	Duration float64 `json:"duration"`
+	Lengths  []int64 `json:"lengths"`
+}
+
+// partialDownload is a track download that can be resumed after an
+// interruption.
+type partialDownload struct {
+	file      *os.File
+	statePath string
+	state     downloadState
+}
+
+// partialPaths returns the partial file and state file for a track saved
+// as base in dir.
+func partialPaths(dir, base string) (string, string) {
+	partPath := filepath.Join(dir, "."+base+".part")
+	return partPath, partPath + ".json"
+}
+
+// openPartial opens the partial download of a track, keeping the segments
+// already fetched when the checkpoint matches the playlist and starting
+// over otherwise.
+func openPartial(dir, base, url string, playlist *HLSPlaylist) (*partialDownload, error) {
+	partPath, statePath := partialPaths(dir, base)
+	expected := downloadState{
+		URL:      url,
+		Format:   streamFormat(playlist),
+		Segments: len(playlist.Segments),
+		Duration: playlist.Duration(),
+		Lengths:  []int64{},
+	}
+
+	state := downloadState{}
+	if data, err := os.ReadFile(statePath); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			state = downloadState{}
+		}
+	}
+	if state.URL != expected.URL || state.Format != expected.Format || state.Segments != expected.Segments || math.Abs(state.Duration-expected.Duration) > 0.001 || len(state.Lengths) > state.Segments {
+		state = expected
+	}
+
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(0)
+	for _, length := range state.Lengths {
+		size += length
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// The partial file is shorter than the checkpoint claims; start over.
+	if info.Size() < size {
+		state = expected
+		size = 0
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	p := &partialDownload{file: file, statePath: statePath, state: state}
+	if err := p.saveState(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// streamFormat identifies the codec and container of a stream, so the
+// segments of a partial download are never joined with those of another
+// format, e.g. after --format changed. SoundCloud names the segments of
+// each format with their own extension, which is all the browser tells.
+func streamFormat(playlist *HLSPlaylist) string {
+	extension := ""
+	if len(playlist.Segments) > 0 {
+		uri, _, _ := strings.Cut(playlist.Segments[0].URI, "?")
+		extension = path.Ext(uri)
+	}
+	return strings.Join([]string{playlist.MimeType, playlist.Codecs, extension}, ";")
+}
+
+// done returns the number of segments already stored.
+func (p *partialDownload) done() int {
+	return len(p.state.Lengths)
+}
+
+// append stores the next segment and records it in the checkpoint.
+func (p *partialDownload) append(data []byte) error {
+	if _, err := p.file.Write(data); err != nil {
+		return err
+	}
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	p.state.Lengths = append(p.state.Lengths, int64(len(data)))
+	return p.saveState()
+}
+
+func (p *partialDownload) saveState() error {
+	data, err := json.Marshal(p.state)
+	if err != nil {
+		return err
+	}
+	tmp := p.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.statePath)
+}
+
+// eachChunk calls fn with every stored segment in order.
+func (p *partialDownload) eachChunk(fn func(index int, data []byte) error) error {
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(p.file)
+	for index, length := range p.state.Lengths {
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("partial download is truncated at segment %d: %w", index, err)
+		}
+		if err := fn(index, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes the partial file, keeping it for a later resume.
+func (p *partialDownload) close() error {
+	return p.file.Close()
+}
+
+// remove deletes the partial file and its checkpoint.
+func (p *partialDownload) remove() error {
+	return errors.Join(
+		p.file.Close(),
+		os.Remove(p.file.Name()),
+		os.Remove(p.statePath),
+	)
+}
+
+// archivedFile returns the file a track was saved to by a previous run, if
+// it is still there.
+func archivedFile(dir, url string) (string, bool) {
+	file, err := os.Open(filepath.Join(dir, archiveName))
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	found := ""
+	for scanner.Scan() {
+		archivedURL, filename, ok := strings.Cut(scanner.Text(), "\t")
+		if ok && archivedURL == url {
+			found = filename
+		}
+	}
+	if found == "" {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(dir, found)); err != nil {
+		return "", false
+	}
+	return found, true
+}
+
+// archiveTrack records that url finished downloading to filename.
+func archiveTrack(dir, url, filename string) error {
+	file, err := os.OpenFile(filepath.Join(dir, archiveName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// A single write keeps concurrent appends from interleaving.
+	_, err = file.Write([]byte(url + "\t" + filename + "\n"))
+	return errors.Join(err, file.Close())
+}
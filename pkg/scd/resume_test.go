@@ -0,0 +1,152 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// streamFetcher is a Fetcher that finds every track's stream at url.
+type streamFetcher struct {
+	url string
+}
+
+func (f *streamFetcher) Open(ctx context.Context, url string) (Page, error) {
+	return nil, ErrFetcherClosed
+}
+
+func (f *streamFetcher) StreamURL(ctx context.Context, url string) (string, error) {
+	return f.url, nil
+}
+
+// mp3Segment is a segment of an MP3 stream, told apart from others by n.
+func mp3Segment(n byte) []byte {
+	return append(bytes.Clone(mp3Frame), n)
+}
+
+func TestOpenPartial(t *testing.T) {
+	playlist := func(mimeType string, segments int) *HLSPlaylist {
+		p := &HLSPlaylist{MimeType: mimeType}
+		for i := 0; i < segments; i++ {
+			p.Segments = append(p.Segments, HLSSegment{URI: fmt.Sprintf("https://cdn.example/%d.128.mp3?Policy=x", i), Duration: 10})
+		}
+		return p
+	}
+	tests := []struct {
+		name     string
+		url      string
+		playlist *HLSPlaylist
+		truncate bool
+		done     int
+	}{
+		{"same stream", "https://soundcloud.com/artist/track", playlist("audio/mpeg", 3), false, 1},
+		{"other format", "https://soundcloud.com/artist/track", playlist(`audio/ogg; codecs="opus"`, 3), false, 0},
+		{"other track", "https://soundcloud.com/artist/other", playlist("audio/mpeg", 3), false, 0},
+		{"other segments", "https://soundcloud.com/artist/track", playlist("audio/mpeg", 4), false, 0},
+		{"truncated partial file", "https://soundcloud.com/artist/track", playlist("audio/mpeg", 3), true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			partial, err := openPartial(dir, "track", "https://soundcloud.com/artist/track", playlist("audio/mpeg", 3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := partial.append([]byte("first")); err != nil {
+				t.Fatal(err)
+			}
+			partial.close()
+			if test.truncate {
+				partPath, _ := partialPaths(dir, "track")
+				os.Truncate(partPath, 2)
+			}
+
+			partial, err = openPartial(dir, "track", test.url, test.playlist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer partial.close()
+			if partial.done() != test.done {
+				t.Errorf("done() = %d, want %d", partial.done(), test.done)
+			}
+			chunks := []string{}
+			partial.eachChunk(func(index int, data []byte) error {
+				chunks = append(chunks, string(data))
+				return nil
+			})
+			if len(chunks) != test.done || (test.done == 1 && chunks[0] != "first") {
+				t.Errorf("stored chunks = %q", chunks)
+			}
+			info, err := partial.file.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != int64(5*test.done) {
+				t.Errorf("partial file is %d bytes, want %d", info.Size(), 5*test.done)
+			}
+		})
+	}
+}
+
+func TestDownloadTrackResume(t *testing.T) {
+	segments := [][]byte{mp3Segment(0), mp3Segment(1), mp3Segment(2)}
+	mutex := sync.Mutex{}
+	requests := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXTINF:1.0,\n/seg/0.mp3\n#EXTINF:1.0,\n/seg/1.mp3\n#EXTINF:1.0,\n/seg/2.mp3\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/seg/{n}", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.PathValue("n")]++
+		first := requests[r.PathValue("n")] == 1
+		mutex.Unlock()
+		// The last segment fails the first time, interrupting the
+		// download.
+		if r.PathValue("n") == "2.mp3" && first {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var n int
+		fmt.Sscanf(r.PathValue("n"), "%d", &n)
+		w.Write(segments[n])
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+	// One segment at a time, so the first two are saved before the last one
+	// fails.
+	client := &Client{Fetcher: &streamFetcher{url: server.URL + "/playlist.m3u8"}, OutputDir: dir, Retry: RetryPolicy{MaxAttempts: 1}, SegmentWorkers: 1}
+	song := &SongData{Title: "Title", Author: "Artist", Url: "https://soundcloud.com/artist/title", Available: true, Duration: 3 * time.Second}
+	if err := client.DownloadTrack(context.Background(), song, ""); err == nil {
+		t.Fatal("DownloadTrack() succeeded with a failing segment")
+	}
+	if err := client.DownloadTrack(context.Background(), song, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"0.mp3": 1, "1.mp3": 1, "2.mp3": 2}
+	for segment, count := range want {
+		if requests[segment] != count {
+			t.Errorf("segment %s fetched %d times, want %d", segment, requests[segment], count)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Artist - Title.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, bytes.Join(segments, nil)) {
+		t.Error("the saved track does not end with the segments in order")
+	}
+	if parts, _ := filepath.Glob(filepath.Join(dir, ".*.part*")); len(parts) != 0 {
+		t.Errorf("partial files left behind: %v", parts)
+	}
+}
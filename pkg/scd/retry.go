@@ -0,0 +1,142 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Delays grow
+// exponentially from BaseDelay up to MaxDelay with random jitter; a
+// Retry-After header sent with a 429 or 503 response takes precedence when
+// it asks for a longer wait.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used when Client.Retry is the zero value.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// retryableError marks a failure worth retrying. after is the delay the
+// server asked for, if any.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// isRetryableStatus reports whether a response status is temporary.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// statusError builds the error for an unexpected response, retryable when
+// the status is temporary.
+func statusError(resp *http.Response, err error) error {
+	if !isRetryableStatus(resp.StatusCode) {
+		return err
+	}
+	retryable := &retryableError{err: err}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		retryable.after = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return retryable
+}
+
+// fetcherError marks the network failures of a Fetcher as retryable. The
+// fetchers of this package mark their temporary failures themselves;
+// other errors, such as ErrFetcherClosed, ErrNoStream or a browser that
+// cannot be launched, are returned as they are.
+func fetcherError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && !errors.As(err, new(*retryableError)) {
+		return &retryableError{err: err}
+	}
+	return err
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return p
+}
+
+// delay returns the wait before the given retry, starting at 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	backoff := p.BaseDelay << (retry - 1)
+	if backoff > p.MaxDelay || backoff <= 0 {
+		backoff = p.MaxDelay
+	}
+	// Equal jitter: half fixed, half random.
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// do calls fn until it succeeds, fails with an error that is not
+// retryable, or runs out of attempts.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	p = p.withDefaults()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		wait := p.delay(attempt)
+		if retryable.after > wait {
+			wait = retryable.after
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// failingFetcher fails every call with err, counts them and records the
+// urls it was asked to open.
+type failingFetcher struct {
+	err    error
+	calls  int
+	opened []string
+}
+
+func (f *failingFetcher) Open(ctx context.Context, url string) (Page, error) {
+	f.calls++
+	f.opened = append(f.opened, url)
+	return nil, f.err
+}
+
+func (f *failingFetcher) StreamURL(ctx context.Context, url string) (string, error) {
+	f.calls++
+	return "", f.err
+}
+
+func TestFetcherErrorsRetried(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"closed fetcher", ErrFetcherClosed, 1},
+		{"no stream", ErrNoStream, 1},
+		{"browser launch", errors.New("cannot init launcher: exec: not found"), 1},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, 3},
+		{"marked by the fetcher", &retryableError{err: errors.New("unexpected status 503")}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetcher := &failingFetcher{err: test.err}
+			client := &Client{Fetcher: fetcher, Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}}
+
+			if _, err := client.openPage(context.Background(), "https://soundcloud.com/a"); !errors.Is(err, test.err) {
+				t.Errorf("openPage() error = %v, want %v", err, test.err)
+			}
+			if fetcher.calls != test.calls {
+				t.Errorf("Open called %d times, want %d", fetcher.calls, test.calls)
+			}
+
+			fetcher.calls = 0
+			if _, err := client.streamPlaylist(context.Background(), &SongData{Url: "https://soundcloud.com/a/b"}); !errors.Is(err, test.err) {
+				t.Errorf("streamPlaylist() error = %v, want %v", err, test.err)
+			}
+			if fetcher.calls != test.calls {
+				t.Errorf("StreamURL called %d times, want %d", fetcher.calls, test.calls)
+			}
+		})
+	}
+}
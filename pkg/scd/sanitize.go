@@ -0,0 +1,153 @@
+package scd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxNameBytes is the longest name given to a file or directory, without
+// the extension. It leaves room for the track id appended on collisions
+// and for the suffixes of partial and temporary files within the 255-byte
+// limit of common filesystems.
+const maxNameBytes = 200
+
+// illegalNameChars are replaced in names, as they are path separators or
+// reserved on Windows.
+const illegalNameChars = `/\:*?"<>|`
+
+// transliterations covers the letters that do not decompose into an ASCII
+// letter and combining marks.
+var transliterations = strings.NewReplacer(
+	"ß", "ss", "ẞ", "SS", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE",
+	"ø", "o", "Ø", "O", "ł", "l", "Ł", "L", "đ", "d", "Đ", "D",
+	"ð", "d", "Ð", "D", "þ", "th", "Þ", "TH", "ı", "i",
+	"‘", "'", "’", "'", "“", `"`, "”", `"`, "–", "-", "—", "-", "…", "...",
+)
+
+// reservedNames cannot be used as file names on Windows, with or without
+// an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// toASCII transliterates s to ASCII, dropping accents and replacing what
+// is left with "_".
+func toASCII(s string) string {
+	stripMarks := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(stripMarks, transliterations.Replace(s))
+	if err != nil {
+		stripped = s
+	}
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return '_'
+		}
+		return r
+	}, stripped)
+}
+
+// cleanName makes s safe to use as a single file or directory name: it is
+// normalized to NFC, or transliterated to ASCII, path separators, reserved
+// characters and control characters are replaced with "_", and leading
+// and trailing spaces and trailing dots are removed.
+func cleanName(s string, ascii bool) string {
+	s = norm.NFC.String(s)
+	if ascii {
+		s = toASCII(s)
+	}
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(illegalNameChars, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.TrimRight(strings.TrimSpace(s), ". ")
+	if s == "" {
+		return ""
+	}
+	// Names starting with a dot would be hidden, or refer to the directory
+	// itself or its parent.
+	if strings.HasPrefix(s, ".") {
+		s = "_" + s[1:]
+	}
+	stem, _, _ := strings.Cut(s, ".")
+	if reservedNames[strings.ToUpper(stem)] {
+		s = "_" + s
+	}
+	return s
+}
+
+// truncateName shortens s to at most limit bytes without splitting a
+// character.
+func truncateName(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	end := limit
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return strings.TrimRight(s[:end], ". ")
+}
+
+// fileName returns the safe name of a file called base with extension ext.
+func fileName(base, ext string, ascii bool) string {
+	base = truncateName(cleanName(base, ascii), maxNameBytes)
+	if base == "" {
+		base = "_"
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// trackKey identifies a track in file names: its id, or a short hash of
+// its url when the id is unknown.
+func trackKey(song *SongData) string {
+	if song.ID != 0 {
+		return strconv.FormatInt(song.ID, 10)
+	}
+	sum := sha1.Sum([]byte(song.Url))
+	return hex.EncodeToString(sum[:4])
+}
+
+// withTrackKey appends the key of song to name, before its extension.
+func withTrackKey(name, ext string, song *SongData) string {
+	suffix := ""
+	if ext != "" {
+		suffix = "." + ext
+	}
+	return strings.TrimSuffix(name, suffix) + " [" + trackKey(song) + "]" + suffix
+}
+
+// claimFile reserves the first of names that is free in dir by creating
+// it empty, so a download never replaces another file. It fails with
+// os.ErrExist when every name is taken.
+func claimFile(dir string, names ...string) (string, error) {
+	var err error
+	for _, name := range names {
+		var file *os.File
+		file, err = os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			return name, file.Close()
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,49 @@
+package scd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkCollisions(t *testing.T) {
+	client := &Client{}
+	jobs := []trackJob{
+		{song: SongData{ID: 1, Author: "Artist", Title: "Title", Url: "https://soundcloud.com/artist/title"}, parentDir: "Set"},
+		{song: SongData{ID: 2, Author: "Artist", Title: "Title", Url: "https://soundcloud.com/artist/title-1"}, parentDir: "Set"},
+		// The same track listed twice is not a collision.
+		{song: SongData{ID: 1, Author: "Artist", Title: "Title", Url: "https://soundcloud.com/artist/title"}, parentDir: "Set"},
+		{song: SongData{ID: 3, Author: "ARTIST", Title: "title", Url: "https://soundcloud.com/artist/title-2"}, parentDir: "Set"},
+		{song: SongData{ID: 4, Author: "Artist", Title: "Title", Url: "https://soundcloud.com/artist/title-3"}, parentDir: "Other"},
+	}
+	client.markCollisions(jobs)
+
+	want := []bool{false, true, false, true, false}
+	for index, job := range jobs {
+		if job.keyed != want[index] {
+			t.Errorf("job %d keyed = %v, want %v", index, job.keyed, want[index])
+		}
+	}
+}
+
+func TestClaimFile(t *testing.T) {
+	dir := t.TempDir()
+	song := &SongData{ID: 42}
+	names := []string{"Artist - Title.mp3", withTrackKey("Artist - Title.mp3", "mp3", song)}
+
+	name, err := claimFile(dir, names...)
+	if err != nil || name != "Artist - Title.mp3" {
+		t.Fatalf("claimFile() = %q, %v, want the plain name", name, err)
+	}
+	name, err = claimFile(dir, names...)
+	if err != nil || name != "Artist - Title [42].mp3" {
+		t.Fatalf("claimFile() = %q, %v, want the keyed name", name, err)
+	}
+	if _, err := claimFile(dir, names...); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("claimFile() error = %v, want os.ErrExist", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Artist - Title [42].mp3")); err != nil {
+		t.Error(err)
+	}
+}
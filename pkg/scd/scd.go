@@ -1,19 +1,19 @@
 package scd
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-rod/rod"
 	"github.com/schollz/progressbar/v3"
 )
 
@@ -31,574 +31,859 @@ const (
 	TRACK_AUTHOR_QUERY           = ".trackItem__username.sc-link-light"
 	TRACK_LIST_LIST_QUERY        = ".trackList__list.sc-clearfix.sc-list-nostyle"
 	TIER_INDICATOR_QUERY         = ".compactTrackListItem__tierIndicator"
+	GENRE_TAG_QUERY              = ".soundTitle__tagContent"
+	RELEASE_TIME_QUERY           = "time.relativeTime"
+	ARTWORK_QUERY                = ".sc-artwork"
+	SET_ARTWORK_QUERY            = ".listenArtworkWrapper .sc-artwork"
 )
 
-func downloadChunk(url string, index int, arr *[]FetchResponse) {
-	resp, err := http.Get(url)
+const maxSearchResults = 15
+
+// openSearchPage loads a search page and returns the result items, or nil
+// when SoundCloud reports that nothing was found.
+func (c *Client) openSearchPage(ctx context.Context, url string) (Page, []Element, error) {
+	page, err := c.openPage(ctx, url)
 	if err != nil {
-		log.Printf("failed to fetch the track: %v", err)
-		return
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("failed to read bytes from the response: %v", err)
-		return
+
+	if err := page.WaitElement(ITEM_QUERY, EMPTY_RESULTS_MESSAGE); err != nil {
+		page.Close()
+		return nil, nil, fmt.Errorf("failed to wait for search results: %w", err)
 	}
-	(*arr)[index] = FetchResponse{
-		data:  data,
-		index: index,
+	if _, err := page.Element(EMPTY_RESULTS_MESSAGE); err == nil {
+		return page, nil, nil
 	}
 
+	listItems, err := page.Elements(ITEM_QUERY)
+	if err != nil {
+		page.Close()
+		return nil, nil, fmt.Errorf("failed to read search results: %w", err)
+	}
+	return page, listItems, nil
 }
 
-func downloadChunks(urls []string) *[]FetchResponse {
-
-	bytesData := make([]FetchResponse, len(urls))
-
-	var wg *sync.WaitGroup = &sync.WaitGroup{}
-	for index, url := range urls {
-		wg.Add(1)
-
-		go func(url string, index int) {
-
-			downloadChunk(url, index, &bytesData)
-			defer func() {
-				wg.Done()
+// searchURL returns the search page at base for query, which is trimmed
+// and escaped so characters such as "&", "#" and "+" stay in it.
+func searchURL(base, query string) string {
+	return base + url.QueryEscape(strings.Trim(query, " "))
+}
 
-			}()
-		}(url, index)
+// SearchSongs searches SoundCloud for tracks matching searchString.
+func (c *Client) SearchSongs(ctx context.Context, searchString string) ([]SongData, error) {
+	if c.API != nil {
+		return c.API.SearchTracks(ctx, strings.Trim(searchString, " "), maxSearchResults)
 	}
+	page, listItems, err := c.openSearchPage(ctx, searchURL(SoundCloudSongSearchURL, searchString))
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
 
-	wg.Wait()
-
-	return &bytesData
+	return createSongDataFromSongSearchResults(listItems)
 }
 
-func SearchSongsByTitle(searchString string) []SongData {
-	browser := setupBrowser()
+// SearchPlaylists searches SoundCloud for playlists matching searchString.
+func (c *Client) SearchPlaylists(ctx context.Context, searchString string) ([]PlaylistData, error) {
+	stop := c.startSpinner("Searching for playlists...")
+	defer stop()
 
-	defer browser.MustClose()
-
-	page := loadPage(browser, SoundCloudSongSearchURL+strings.Trim(searchString, " "))
-	defer page.MustClose()
+	if c.API != nil {
+		return c.API.SearchPlaylists(ctx, strings.Trim(searchString, " "), maxSearchResults)
+	}
 
-	err := acceptCookiesAndHandlePage(page)
+	page, listItems, err := c.openSearchPage(ctx, searchURL(SoundCloudPlaylistSearchURL, searchString))
 	if err != nil {
-		log.Println("failed to accept cookies and handle page", err)
+		return nil, err
 	}
+	defer page.Close()
 
-	if _, err := page.Timeout(500 * time.Microsecond).Element(EMPTY_RESULTS_MESSAGE); err == nil {
-		return []SongData{}
+	if len(listItems) > maxSearchResults {
+		listItems = listItems[0:maxSearchResults]
 	}
-
-	listItems := page.MustElements(ITEM_QUERY)
-
-	fmt.Println("Len results", len(listItems))
-	return createSongDataFromSongSearchResults(listItems)
+	return createSongDataFromPlaylistSearchResults(listItems)
 }
 
-func SearchPlaylistsByTitle(searchString string) []PlaylistData {
-	bar := progressbar.NewOptions(-1, progressbar.OptionSetDescription("Searching for playlists..."), progressbar.OptionSetItsString(""), progressbar.OptionSpinnerType(11), progressbar.OptionClearOnFinish(), progressbar.OptionSetElapsedTime(false))
-	defer bar.Close()
-	finishedChan := make(chan struct{})
-	go func(bar *progressbar.ProgressBar, finished <-chan struct{}) {
-		for {
-			select {
-			case <-finishedChan:
-				bar.Finish()
-				close(finishedChan)
-				return
-			default:
-				{
-					time.Sleep(time.Millisecond * 500)
-					bar.Add(1)
-				}
-			}
-		}
-	}(bar, finishedChan)
-	browser := setupBrowser()
+// SearchAlbums searches SoundCloud for albums matching searchString.
+func (c *Client) SearchAlbums(ctx context.Context, searchString string) ([]AlbumData, error) {
+	stop := c.startSpinner("Searching for albums...")
+	defer stop()
 
-	defer browser.MustClose()
-	page := loadPage(browser, SoundCloudPlaylistSearchURL+strings.Trim(searchString, " "))
-	defer page.MustClose()
+	if c.API != nil {
+		return c.API.SearchAlbums(ctx, strings.Trim(searchString, " "), maxSearchResults)
+	}
 
-	err := acceptCookiesAndHandlePage(page)
+	page, listItems, err := c.openSearchPage(ctx, searchURL(SoundCloudAlbumSearchURL, searchString))
 	if err != nil {
-		log.Println("failed to accept cookies and handle page", err)
-	}
-	if _, err := page.Timeout(200 * time.Microsecond).Element(EMPTY_RESULTS_MESSAGE); err == nil {
-		return []PlaylistData{}
+		return nil, err
 	}
+	defer page.Close()
 
-	listItems := page.MustElements(ITEM_QUERY)
-	if len(listItems) > 15 {
-		listItems = listItems[0:15]
+	if len(listItems) > maxSearchResults {
+		listItems = listItems[0:maxSearchResults]
 	}
-	data := createSongDataFromPlaylistSearchResults(listItems)
-	finishedChan <- struct{}{}
-	return data
+	return createSongDataFromAlbumSearchResults(listItems)
 }
 
-func SearchAlbumsByTitle(searchString string) []AlbumData {
-	bar := progressbar.NewOptions(-1, progressbar.OptionSetDescription("Searching for albums..."), progressbar.OptionSetItsString(""), progressbar.OptionSpinnerType(11), progressbar.OptionClearOnFinish(), progressbar.OptionSetElapsedTime(false))
-	defer bar.Close()
-	finishedChan := make(chan struct{})
-	go func(bar *progressbar.ProgressBar, finished <-chan struct{}) {
-		for {
-			select {
-			case <-finishedChan:
-				bar.Finish()
-				close(finishedChan)
-				return
-			default:
-				{
-					time.Sleep(time.Millisecond * 500)
-					bar.Add(1)
-				}
-			}
-		}
-	}(bar, finishedChan)
-	browser := setupBrowser()
-
-	defer browser.MustClose()
-	page := loadPage(browser, SoundCloudAlbumSearchURL+strings.Trim(searchString, " "))
-	defer page.MustClose()
+func elementText(item Element, selector string) (string, error) {
+	el, err := item.Element(selector)
+	if err != nil {
+		return "", fmt.Errorf("missing %s: %w", selector, err)
+	}
+	return el.Text()
+}
 
-	err := acceptCookiesAndHandlePage(page)
+func elementHref(item Element, selector string) (string, error) {
+	el, err := item.Element(selector)
+	if err != nil {
+		return "", fmt.Errorf("missing %s: %w", selector, err)
+	}
+	href, ok, err := el.Attribute("href")
 	if err != nil {
-		log.Println("failed to accept cookies and handle page", err)
+		return "", err
 	}
-	if _, err := page.Timeout(200 * time.Microsecond).Element(EMPTY_RESULTS_MESSAGE); err == nil {
-		return []AlbumData{}
+	if !ok {
+		return "", fmt.Errorf("%s has no href", selector)
 	}
+	return SoundCloudBaseURL + href, nil
+}
 
-	listItems := page.MustElements(ITEM_QUERY)
-
-	if len(listItems) > 15 {
-		listItems = listItems[0:15]
+// elementTime returns the datetime attribute of the child matching
+// selector, or the zero time.
+func elementTime(item Element, selector string) time.Time {
+	el, err := item.Element(selector)
+	if err != nil {
+		return time.Time{}
 	}
-	data := createSongDataFromAlbumSearchResults(listItems)
-	finishedChan <- struct{}{}
-	return data
+	datetime, _, _ := el.Attribute("datetime")
+	released, _ := time.Parse(time.RFC3339, datetime)
+	return released
 }
 
-func createSongDataFromSongSearchResults(listItems []*rod.Element) []SongData {
+func createSongDataFromSongSearchResults(listItems []Element) ([]SongData, error) {
 	output := []SongData{}
 	for _, item := range listItems {
 		_, err := item.Element(PLAY_BUTTON_QUERY)
 		isDisabled := err != nil
 
+		title, err := elementText(item, TITLE_LINK_QUERY)
+		if err != nil {
+			return nil, err
+		}
+		author, err := elementText(item, AUTHOR_USERNAME_QUERY)
+		if err != nil {
+			return nil, err
+		}
+		url, err := elementHref(item, TITLE_LINK_QUERY)
+		if err != nil {
+			return nil, err
+		}
+
+		genre, _ := elementText(item, GENRE_TAG_QUERY)
+		uploaded := elementTime(item, RELEASE_TIME_QUERY)
+		year := 0
+		if !uploaded.IsZero() {
+			year = uploaded.Year()
+		}
+
 		output = append(output, SongData{
-			Title:     item.MustElement(TITLE_LINK_QUERY).MustText(),
-			Author:    item.MustElement(AUTHOR_USERNAME_QUERY).MustText(),
-			Url:       SoundCloudBaseURL + *item.MustElement(TITLE_LINK_QUERY).MustAttribute("href"),
-			Available: isDisabled,
+			Title:      title,
+			Author:     author,
+			Url:        url,
+			Available:  isDisabled,
+			Genre:      genre,
+			Year:       year,
+			Uploaded:   uploaded,
+			ArtworkURL: elementArtwork(item, ARTWORK_QUERY),
 		})
 	}
-	return output
+	return output, nil
+}
+
+// readSetSearchResult expands a playlist or album search result and reads
+// its title, author, url and number of tracks.
+func readSetSearchResult(item Element) (title, author, url string, count int, err error) {
+	if err := item.Expand(MORE_LINK_QUERY); err != nil && !errors.Is(err, ErrElementNotFound) {
+		return "", "", "", 0, err
+	}
+
+	tracks, err := item.Elements(COMPACT_TRACKLIST_ITEM_QUERY)
+	if err != nil {
+		return "", "", "", 0, err
+	}
+	count = len(tracks)
+	if count == 0 {
+		return "", "", "", 0, nil
+	}
+
+	if title, err = elementText(item, TITLE_LINK_QUERY); err != nil {
+		return "", "", "", 0, err
+	}
+	if author, err = elementText(item, AUTHOR_USERNAME_QUERY); err != nil {
+		return "", "", "", 0, err
+	}
+	if url, err = elementHref(item, TITLE_LINK_QUERY); err != nil {
+		return "", "", "", 0, err
+	}
+	return title, author, url, count, nil
 }
 
-func createSongDataFromPlaylistSearchResults(listItems []*rod.Element) []PlaylistData {
+func createSongDataFromPlaylistSearchResults(listItems []Element) ([]PlaylistData, error) {
 	output := []PlaylistData{}
 
 	for _, item := range listItems {
-		moreThenTen, err := item.Element(MORE_LINK_QUERY)
-		if err == nil {
-			moreThenTen.MustClick()
-			item.MustWait(`() => document.querySelector("` + MORE_LINK_QUERY + `").textContent === "View fewer tracks"`)
+		title, author, url, count, err := readSetSearchResult(item)
+		if err != nil {
+			return nil, err
 		}
-
-		count := len(item.MustElements(COMPACT_TRACKLIST_ITEM_QUERY))
 		if count == 0 {
 			continue
 		}
 		output = append(output, PlaylistData{
-			Title:      item.MustElement(TITLE_LINK_QUERY).MustText(),
-			Author:     item.MustElement(AUTHOR_USERNAME_QUERY).MustText(),
-			Url:        SoundCloudBaseURL + *item.MustElement(TITLE_LINK_QUERY).MustAttribute("href"),
+			Title:      title,
+			Author:     author,
+			Url:        url,
 			TrackCount: count,
+			ArtworkURL: elementArtwork(item, ARTWORK_QUERY),
 		})
-
 	}
-	return output
+	return output, nil
 }
 
-func createSongDataFromAlbumSearchResults(listItems []*rod.Element) []AlbumData {
+func createSongDataFromAlbumSearchResults(listItems []Element) ([]AlbumData, error) {
 	output := []AlbumData{}
 
 	for _, item := range listItems {
-
-		moreThenTen, err := item.Element(MORE_LINK_QUERY)
-		if err == nil {
-			moreThenTen.MustClick()
-			item.MustWait(`() => document.querySelector("` + MORE_LINK_QUERY + `").textContent === "View fewer tracks"`)
+		title, author, url, count, err := readSetSearchResult(item)
+		if err != nil {
+			return nil, err
 		}
-
-		count := len(item.MustElements(COMPACT_TRACKLIST_ITEM_QUERY))
 		if count == 0 {
 			continue
 		}
 		output = append(output, AlbumData{
-			Title:      item.MustElement(TITLE_LINK_QUERY).MustText(),
-			Author:     item.MustElement(AUTHOR_USERNAME_QUERY).MustText(),
-			Url:        SoundCloudBaseURL + *item.MustElement(TITLE_LINK_QUERY).MustAttribute("href"),
+			Title:      title,
+			Author:     author,
+			Url:        url,
 			TrackCount: count,
+			ArtworkURL: elementArtwork(item, ARTWORK_QUERY),
 		})
+	}
+	return output, nil
+}
 
+// outputDir creates and returns the client's output directory, or
+// parentDir inside it.
+func (c *Client) outputDir(parentDir string) (string, error) {
+	root := c.OutputDir
+	if root == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		root = filepath.Join(currentUser.HomeDir, "soundcloud-downloader")
+	}
+	dir := filepath.Join(root, parentDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
 	}
-	return output
+	return dir, nil
 }
 
-func DownloadTrack(songData *SongData, parentDir string) {
-	browser := setupBrowser()
-
-	defer browser.MustClose()
-
-	hijackedUrl := []string{}
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-
-	router := browser.HijackRequests()
-	router.MustAdd("*", func(ctx *rod.Hijack) {
-		ctx.LoadResponse(&http.Client{}, true)
-		if strings.Contains(ctx.Request.URL().String(), "m3u8") {
-			hijackedUrl = regexp.MustCompile(`(https?:\/\/[^\s]+)`).FindAllString(ctx.Response.Body(), -1)
-			router.MustRemove("*")
-			router.MustStop()
-			wg.Done()
+// trackPath returns the directory song is saved in, relative to the
+// output directory, and the name of its file for a given extension, or
+// without one when ext is empty. parentDir is only used when the client
+// has no Template.
+func (c *Client) trackPath(song *SongData, parentDir string) (string, func(ext string) string) {
+	if c.Template == nil {
+		return parentDir, func(ext string) string {
+			return fileName(fmt.Sprintf("%s - %s", song.Author, song.Title), ext, c.ASCIINames)
 		}
-	})
-	go router.Run()
+	}
+	// {ext} is only allowed in the file name, so the directory does not
+	// depend on it.
+	return filepath.Dir(c.Template.render(song, "", c.ASCIINames)), func(ext string) string {
+		return filepath.Base(c.Template.render(song, ext, c.ASCIINames))
+	}
+}
 
-	page := loadPage(browser, songData.Url)
+// trackFile is trackPath with the directory created inside the output
+// directory.
+func (c *Client) trackFile(song *SongData, parentDir string) (string, func(ext string) string, error) {
+	relative, filename := c.trackPath(song, parentDir)
+	dir, err := c.outputDir(relative)
+	return dir, filename, err
+}
 
-	defer page.MustClose()
-	wg.Wait()
-	chunks := *downloadChunks(hijackedUrl)
-	rawBytes := []byte{}
-	for _, resp := range chunks {
-		rawBytes = append(rawBytes, resp.data...)
+// setDir returns the directory the tracks of a playlist or album are saved
+// in when the client has no Template.
+func (c *Client) setDir(title, author string) string {
+	return fileName(fmt.Sprintf("%s - %s", title, author), "", c.ASCIINames)
+}
+
+// DownloadTrack downloads a single track into the client's output
+// directory, at the path given by the client's Template or otherwise
+// inside parentDir. Segments are
+// checkpointed to disk as they arrive, so an interrupted download resumes
+// where it stopped, and a track that already finished is skipped. The
+// download rate is shown while it runs.
+func (c *Client) DownloadTrack(ctx context.Context, songData *SongData, parentDir string) error {
+	stop := c.startSpinnerFunc(c.rateDescription("Downloading"))
+	defer stop()
+	return c.downloadTrack(ctx, songData, parentDir, false)
+}
+
+// downloadTrack downloads a track. keyed saves it under its name with the
+// track's key appended, for tracks sharing a name with another one of the
+// same run.
+func (c *Client) downloadTrack(ctx context.Context, songData *SongData, parentDir string, keyed bool) error {
+	dir, filename, err := c.trackFile(songData, parentDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := archivedFile(dir, songData.Url); ok {
+		return nil
+	}
+
+	playlist, err := c.streamPlaylist(ctx, songData)
+	if err != nil {
+		return fmt.Errorf("failed to find the stream of %s: %w", songData.Url, err)
+	}
+	if len(playlist.Segments) == 0 {
+		return fmt.Errorf("the stream of %s has no segments", songData.Url)
 	}
-	currentUser, err := user.Current()
+
+	// The partial and temporary files carry the track's key, so tracks
+	// sharing a name do not share them.
+	base := filename("") + " [" + trackKey(songData) + "]"
+	partial, err := openPartial(dir, base, songData.Url, playlist)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("cannot open partial download: %w", err)
 	}
-	var dir string
-	if parentDir == "" {
-		dir = filepath.Join(currentUser.HomeDir, "soundcloud-downloader")
-	} else {
-		dir = filepath.Join(currentUser.HomeDir, "soundcloud-downloader", parentDir)
+	err = c.downloadChunks(ctx, playlist.Segments, partial.done(), func(index int, data []byte) error {
+		return partial.append(data)
+	})
+	if err != nil {
+		partial.close()
+		return err
 	}
 
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		err = os.MkdirAll(dir, os.ModePerm)
+	tags := songTags(songData)
+	if songData.ArtworkURL != "" {
+		artwork, err := c.fetchArtwork(ctx, songData.ArtworkURL)
 		if err != nil {
-			fmt.Println("Error creating directory:", err)
-			return
+			log.Println("failed to fetch artwork", err)
 		}
-	} else if err != nil {
-		fmt.Println("Error checking directory:", err)
-		return
+		tags.Artwork = artwork
 	}
-	filename := fmt.Sprintf("%s - %s.mp3", songData.Author, songData.Title)
-	filepath := fmt.Sprintf("%s/%s", dir, filename)
-	ioutil.WriteFile(filepath, rawBytes, 0644)
-}
 
-func DownloadPlaylist(playlistData *PlaylistData) {
-	prepareBar := progressbar.NewOptions(-1, progressbar.OptionSetDescription("Gathering tracks information"), progressbar.OptionSetItsString(""), progressbar.OptionSpinnerType(11), progressbar.OptionClearOnFinish(), progressbar.OptionSetElapsedTime(false), progressbar.OptionSetRenderBlankState(true))
-	triggerCloseBar := make(chan struct{})
-
-	go func() {
-		for {
-			select {
-			case <-triggerCloseBar:
-				return
-			default:
-				prepareBar.Add(1)
-				time.Sleep(100 * time.Millisecond)
+	// The file is written under a temporary name and only renamed into
+	// place once it is complete and verified, so an interrupted run never
+	// leaves a truncated file that looks finished.
+	file, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		partial.close()
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	var mux muxer
+	written := 0
+	output := bufio.NewWriter(file)
+	err = partial.eachChunk(func(index int, data []byte) error {
+		if mux == nil {
+			if mux, err = newMuxer(data, playlist.Codecs, tags); err != nil {
+				return fmt.Errorf("cannot detect the format of %s: %w", songData.Url, err)
 			}
 		}
-	}()
-
-	browser := setupBrowser()
-
-	defer browser.MustClose()
+		if err := mux.writeChunk(output, data); err != nil {
+			return fmt.Errorf("segment %d: %w", index, err)
+		}
+		written++
+		return nil
+	})
+	if err == nil {
+		err = mux.finish(output)
+	}
+	if err == nil {
+		err = output.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error writing %s: %w", file.Name(), closeErr)
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err != nil {
+		partial.close()
+		return err
+	}
+	duration := c.trackDuration(ctx, songData)
+	if duration == 0 {
+		log.Println("the duration of", songData.Url, "is unknown, only its size is verified")
+	}
+	if err := verifyDownload(file.Name(), playlist, written, duration); err != nil {
+		// The stored segments cannot produce a valid file; start over on
+		// the next attempt.
+		if removeErr := partial.remove(); removeErr != nil {
+			log.Println("failed to remove partial download", removeErr)
+		}
+		return fmt.Errorf("%s: %w", songData.Url, err)
+	}
 
-	page := loadPage(browser, playlistData.Url)
+	names := []string{filename(mux.ext()), withTrackKey(filename(mux.ext()), mux.ext(), songData)}
+	if keyed {
+		names = names[1:]
+	}
+	name, err := claimFile(dir, names...)
+	if err != nil {
+		partial.close()
+		return fmt.Errorf("cannot create %s: %w", names[len(names)-1], err)
+	}
+	if err := os.Rename(file.Name(), filepath.Join(dir, name)); err != nil {
+		os.Remove(filepath.Join(dir, name))
+		partial.close()
+		return fmt.Errorf("cannot move the download into place: %w", err)
+	}
+	if err := partial.remove(); err != nil {
+		log.Println("failed to remove partial download", err)
+	}
+	return archiveTrack(dir, songData.Url, name)
+}
 
-	err := acceptCookiesAndHandlePage(page)
+// trackDuration returns the length of song to verify its download
+// against. Search results and scraped set tracks come without one, so it
+// is read from the track page then. It is zero when it stays unknown.
+func (c *Client) trackDuration(ctx context.Context, song *SongData) time.Duration {
+	if song.Duration > 0 || song.Url == "" {
+		return song.Duration
+	}
+	resource, err := c.Lookup(ctx, song.Url)
 	if err != nil {
-		log.Println("failed to accept cookies and handle page", err)
+		log.Println("failed to look up the duration of", song.Url, err)
+		return 0
 	}
+	if resource.Track == nil {
+		return 0
+	}
+	return resource.Track.Duration
+}
 
-	currentTracksReveiled := 0
-	for currentTracksReveiled < playlistData.TrackCount {
+// setInfo describes the playlist or album a set of tracks is downloaded
+// from.
+type setInfo struct {
+	// id is the API id of the set, or zero when unknown.
+	id int64
+	// secret is the token of a private set's share link, which its url
+	// may lack.
+	secret     string
+	url        string
+	title      string
+	author     string
+	trackCount int
+	artworkURL string
+	album      bool
+}
 
-		dims := page.MustElement(TRACK_LIST_LIST_QUERY).MustShape().Box()
-		page.Mouse.MustScroll(0, dims.Y+dims.Height)
+// collectSetTracks reads the tracks of a playlist or album page. They are
+// taken from the hydration data when the page embeds every track in full;
+// otherwise the page is scrolled until all tracks are revealed and they
+// are scraped. The tracks of an album are credited to the album's author,
+// those of a playlist to the author shown on the page.
+func collectSetTracks(page Page, set setInfo) ([]SongData, int, error) {
+	if hydration, err := pageHydration(page); err == nil && hydration.set != nil && len(hydration.set.Tracks) > 0 &&
+		len(hydration.set.completeTracks()) == len(hydration.set.Tracks) {
+		return setSongs(set, hydration.set)
+	}
 
-		page.MustWait(`() => !!Array.from(document.querySelectorAll("` + TRACK_LIST_ITEM_QUERY + `")).slice(-1)[0].querySelector(".trackItem__content.sc-truncate")`)
-		currentTracksReveiled = len(page.MustElements(TRACK_LIST_ITEM_QUERY))
-		if currentTracksReveiled == playlistData.TrackCount {
-			break
+	if err := page.ScrollUntil(TRACK_LIST_ITEM_QUERY, set.trackCount); err != nil {
+		return nil, 0, err
+	}
+	if set.artworkURL == "" {
+		if artwork, err := page.Element(SET_ARTWORK_QUERY); err == nil {
+			set.artworkURL = styleArtwork(artwork)
 		}
 	}
-	elements := page.MustElements(TRACK_LIST_ITEM_QUERY)
-	if len(elements) == 0 {
-		log.Fatal("no matching elements found")
+
+	elements, err := page.Elements(TRACK_LIST_ITEM_QUERY)
+	if err != nil {
+		return nil, 0, err
 	}
-	last := elements[len(elements)-1]
-	shape := last.MustShape()
-	if shape == nil {
-		log.Fatal("element has no shape")
+	if len(elements) == 0 {
+		return nil, 0, errors.New("no matching elements found")
 	}
-	page.Mouse.MustScroll(0, shape.Box().Y)
-	defer page.MustClose()
 
-	filteredElements := []*rod.Element{}
-	notAvailableElements := []int{}
+	songs := []SongData{}
+	notAvailable := 0
 	for index, element := range elements {
-		_, err := element.Element(TIER_INDICATOR_QUERY)
+		if _, err := element.Element(TIER_INDICATOR_QUERY); err == nil {
+			notAvailable++
+			continue
+		}
+
+		url, err := elementHref(element, TRACK_TITLE_QUERY)
 		if err != nil {
-			filteredElements = append(filteredElements, element)
+			return nil, 0, err
+		}
+		title, _ := elementText(element, TRACK_TITLE_QUERY)
+		song := SongData{
+			Title:       title,
+			Url:         url,
+			Author:      set.author,
+			Available:   true,
+			ArtworkURL:  set.artworkURL,
+			Playlist:    set.title,
+			Album:       set.title,
+			TrackNumber: index + 1,
+			TrackTotal:  len(elements),
+		}
+		if set.album {
+			song.AlbumArtist = set.author
 		} else {
-			notAvailableElements = append(notAvailableElements, index)
+			song.Author, _ = elementText(element, TRACK_AUTHOR_QUERY)
 		}
+		songs = append(songs, song)
 	}
-	songs := make([]SongData, len(filteredElements))
-	var wg *sync.WaitGroup = &sync.WaitGroup{}
+	return songs, notAvailable, nil
+}
 
-	mutex := &sync.Mutex{} // declare a mutex
+// setTracks reads the tracks of a playlist or album from the API, or from
+// its page when the client has no API and the set was not listed by the
+// API, as user collections are.
+func (c *Client) setTracks(ctx context.Context, set setInfo) ([]SongData, int, error) {
+	if c.API != nil || set.id != 0 {
+		return c.api().setTracks(ctx, set)
+	}
+	page, err := c.openPage(ctx, set.url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer page.Close()
+	return collectSetTracks(page, set)
+}
 
-	for index, element := range elements {
-		wg.Add(1)
-		go func(element *rod.Element, index int, output *[]SongData, wg *sync.WaitGroup) {
-			mutex.Lock()         // lock the shared variable before modification
-			defer mutex.Unlock() // release the lock after modification
-
-			title, err := element.Element(TRACK_TITLE_QUERY)
-			if err != nil {
-				title = nil
-			}
-			url, err := element.Element(TRACK_TITLE_QUERY)
-			if err != nil {
+// trackJob is a track to download into parentDir. keyed is set by
+// markCollisions.
+type trackJob struct {
+	song      SongData
+	parentDir string
+	keyed     bool
+}
 
-				log.Panicln(err, " url ", index)
-			}
-			author, err := element.Element(TRACK_AUTHOR_QUERY)
-			if err != nil {
-				author = nil
-			}
-			song := SongData{
-				Title: func() string {
-					if title == nil {
-						return ""
-					}
-					return title.MustText()
-				}(),
-				Url: SoundCloudBaseURL + *url.MustAttribute("href"),
-				Author: func() string {
-					if author == nil {
-						return ""
-					}
-					return author.MustText()
-				}(),
-				Available: true,
-			}
-			(*output)[index] = song
-			wg.Done()
-		}(element, index, &songs, wg)
+// markCollisions sets keyed on the jobs whose file would get the name of
+// the file of an earlier job, so which track gets the plain name does not
+// depend on which one finishes first. Names are compared ignoring case,
+// as some filesystems do.
+func (c *Client) markCollisions(jobs []trackJob) {
+	seen := map[string]string{}
+	for index := range jobs {
+		c.markCollision(seen, &jobs[index])
 	}
-	wg.Wait()
-	triggerCloseBar <- struct{}{}
-	prepareBar.Close()
-	songsChunks := createChunks(&songs, 3)
+}
 
-	loadingBar := progressbar.NewOptions(
-		len(songs),
-		progressbar.OptionFullWidth(),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetDescription("Downloading"),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetItsString(""),
-		progressbar.OptionSpinnerType(11),
-		progressbar.OptionClearOnFinish(),
-		progressbar.OptionShowCount(),
-	)
+// markCollision marks job when seen, the names of the earlier jobs, holds
+// its name for another track, and adds its name otherwise.
+func (c *Client) markCollision(seen map[string]string, job *trackJob) {
+	dir, filename := c.trackPath(&job.song, job.parentDir)
+	name := strings.ToLower(filepath.Join(dir, filename("")))
+	if url, ok := seen[name]; ok && url != job.song.Url {
+		job.keyed = true
+		return
+	}
+	seen[name] = job.song.Url
+}
 
-	if len(notAvailableElements) > 0 {
-		fmt.Println(Colorize("yellow", "Warning: some songs won't be downloaded as they are not available!"))
-	}
-
-	finished := []int{}
-	for _, chunk := range songsChunks {
-		wg.Add(len(chunk))
-		for _, song := range chunk {
-			if song.Available {
-				go func(song SongData) {
-					DownloadTrack(&song, fmt.Sprintf("%s - %s", playlistData.Title, playlistData.Author))
-					finished = append(finished, 1)
-					loadingBar.Add(1)
-					wg.Done()
-				}(song)
-			} else {
-				wg.Done()
-			}
+// setJobs reads the tracks of a playlist or album page to download into
+// parentDir, with the number of tracks left out as unavailable. The cover
+// of an album is saved into its folder.
+func (c *Client) setJobs(ctx context.Context, set setInfo, parentDir string) ([]trackJob, int, error) {
+	stop := c.startSpinner("Gathering tracks information")
+	songs, notAvailable, err := c.setTracks(ctx, set)
+	stop()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read the tracks of %s: %w", set.url, err)
+	}
+
+	if set.album && len(songs) > 0 && songs[0].ArtworkURL != "" {
+		if err := c.saveFolderArtwork(ctx, &songs[0], parentDir); err != nil {
+			log.Println("failed to save album artwork", err)
+		}
+	}
+	jobs := []trackJob{}
+	for _, song := range songs {
+		if !song.Available {
+			notAvailable++
+			continue
 		}
-		wg.Wait()
+		jobs = append(jobs, trackJob{song: song, parentDir: parentDir})
 	}
+	return jobs, notAvailable, nil
+}
 
-	go func() {
-		for {
-			fmt.Printf("%d/%d \r", len(finished), len(songs))
-			time.Sleep(1 * time.Second)
+// downloadSet downloads every track of a playlist or album page into
+// parentDir.
+func (c *Client) downloadSet(ctx context.Context, set setInfo, parentDir string) error {
+	jobs, notAvailable, err := c.setJobs(ctx, set, parentDir)
+	if err != nil {
+		return err
+	}
+	return jobsError(ctx, jobs, c.downloadJobs(ctx, jobs, notAvailable))
+}
+
+// downloadJobs downloads the tracks of jobs, TrackWorkers at a time, and
+// warns about the notAvailable tracks left out. It returns the error of
+// each job, which is the context's error for jobs never started.
+func (c *Client) downloadJobs(ctx context.Context, jobs []trackJob, notAvailable int) []error {
+	if notAvailable > 0 {
+		c.warnNotAvailable()
+	}
+	errs := make([]error, len(jobs))
+	finished := make([]bool, len(jobs))
+	pool := c.startDownloads(ctx, len(jobs), func(index int, err error) {
+		errs[index] = err
+		finished[index] = true
+	})
+	for _, job := range jobs {
+		if !pool.add(job) {
+			break
 		}
-	}()
+	}
+	pool.wait()
 
+	for index := range jobs {
+		if !finished[index] {
+			errs[index] = ctx.Err()
+		}
+	}
+	return errs
 }
 
-func DownloadAlbum(albumData *AlbumData) {
-	prepareBar := progressbar.NewOptions(-1, progressbar.OptionSetDescription("Gathering tracks information"), progressbar.OptionSetItsString(""), progressbar.OptionSpinnerType(11), progressbar.OptionClearOnFinish(), progressbar.OptionSetElapsedTime(false), progressbar.OptionSetRenderBlankState(true))
-	triggerCloseBar := make(chan struct{})
+func (c *Client) warnNotAvailable() {
+	fmt.Fprintln(c.progress(), Colorize("yellow", "Warning: some songs won't be downloaded as they are not available!"))
+}
+
+// downloadPool downloads the tracks of the jobs added to it, TrackWorkers
+// at a time, behind one progress bar. Jobs are numbered in the order they
+// are added, and marked for collisions with the jobs added before them.
+type downloadPool struct {
+	client *Client
+	ctx    context.Context
+	queue  chan int
+	bar    *progressbar.ProgressBar
+	done   chan struct{}
+	// report is called with the number and the error of every finished
+	// job, one at a time.
+	report  func(index int, err error)
+	workers sync.WaitGroup
+
+	mutex sync.Mutex
+	jobs  []trackJob
+	seen  map[string]string
+}
+
+// startDownloads starts a download pool whose progress bar counts total
+// jobs until more are added.
+func (c *Client) startDownloads(ctx context.Context, total int, report func(index int, err error)) *downloadPool {
+	p := &downloadPool{
+		client: c,
+		ctx:    ctx,
+		queue:  make(chan int),
+		done:   make(chan struct{}),
+		report: report,
+		seen:   map[string]string{},
+	}
+	p.bar = progressbar.NewOptions(
+		total,
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+		progressbar.OptionSetDescription("Downloading"),
+		progressbar.OptionSetWriter(c.progress()),
+		progressbar.OptionSetItsString(""),
+		progressbar.OptionSpinnerType(11),
+		progressbar.OptionClearOnFinish(),
+		progressbar.OptionShowCount(),
+	)
+	// Spinners would draw over the progress bar.
+	c.downloading.Add(1)
 
+	// Keep the transfer rate in the description up to date.
+	describe := c.rateDescription("Downloading")
 	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-triggerCloseBar:
-				close(triggerCloseBar)
+			case <-ticker.C:
+				p.bar.Describe(describe())
+			case <-p.done:
 				return
-			default:
-				prepareBar.Add(1)
-				time.Sleep(100 * time.Millisecond)
 			}
 		}
 	}()
-	browser := setupBrowser()
 
-	defer browser.MustClose()
+	for i := 0; i < c.trackWorkers(); i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	return p
+}
 
-	page := loadPage(browser, albumData.Url)
+func (p *downloadPool) work() {
+	defer p.workers.Done()
+	for index := range p.queue {
+		p.mutex.Lock()
+		job := p.jobs[index]
+		p.mutex.Unlock()
+		err := p.client.downloadTrack(p.ctx, &job.song, job.parentDir, job.keyed)
+		p.mutex.Lock()
+		p.report(index, err)
+		p.bar.Add(1)
+		p.mutex.Unlock()
+	}
+}
 
-	err := acceptCookiesAndHandlePage(page)
-	if err != nil {
-		log.Println("failed to accept cookies and handle page", err)
+// add queues job and waits for a worker to take it. It returns false when
+// the context is done first, leaving the job unstarted.
+func (p *downloadPool) add(job trackJob) bool {
+	p.mutex.Lock()
+	p.client.markCollision(p.seen, &job)
+	index := len(p.jobs)
+	p.jobs = append(p.jobs, job)
+	if len(p.jobs) > p.bar.GetMax() {
+		p.bar.ChangeMax(len(p.jobs))
 	}
+	p.mutex.Unlock()
 
-	currentTracksReveiled := 0
-	for currentTracksReveiled < albumData.TrackCount {
+	select {
+	case p.queue <- index:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
 
-		dims := page.MustElement(TRACK_LIST_LIST_QUERY).MustShape().Box()
-		page.Mouse.MustScroll(0, dims.Y+dims.Height)
+// wait waits for the added jobs to finish and removes the progress bar.
+// No jobs can be added afterwards.
+func (p *downloadPool) wait() {
+	close(p.queue)
+	p.workers.Wait()
+	close(p.done)
+	p.bar.Close()
+	p.client.downloading.Add(-1)
+}
 
-		page.MustWait(`() => !!Array.from(document.querySelectorAll("` + TRACK_LIST_ITEM_QUERY + `")).slice(-1)[0].querySelector(".trackItem__content.sc-truncate")`)
-		currentTracksReveiled = len(page.MustElements(TRACK_LIST_ITEM_QUERY))
-		if currentTracksReveiled == albumData.TrackCount {
-			break
+// jobsError joins the errors returned by downloadJobs, or returns the
+// context's error when the downloads were cancelled.
+func jobsError(ctx context.Context, jobs []trackJob, errs []error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	failed := []error{}
+	for index, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", jobs[index].song.Url, err))
 		}
 	}
-	elements := page.MustElements(TRACK_LIST_ITEM_QUERY)
-	if len(elements) == 0 {
-		log.Fatal("no matching elements found")
+	return errors.Join(failed...)
+}
+
+// saveFolderArtwork writes the artwork of song into the directory it is
+// saved in.
+func (c *Client) saveFolderArtwork(ctx context.Context, song *SongData, parentDir string) error {
+	artwork, err := c.fetchArtwork(ctx, song.ArtworkURL)
+	if err != nil {
+		return err
 	}
-	last := elements[len(elements)-1]
-	shape := last.MustShape()
-	if shape == nil {
-		log.Fatal("element has no shape")
+	dir, _, err := c.trackFile(song, parentDir)
+	if err != nil {
+		return err
 	}
-	page.Mouse.MustScroll(0, shape.Box().Y)
-	defer page.MustClose()
+	return writeFolderArtwork(dir, artwork)
+}
 
-	filteredElements := []*rod.Element{}
-	notAvailableElements := []int{}
-	for index, element := range elements {
-		_, err := element.Element(TIER_INDICATOR_QUERY)
-		if err != nil {
-			filteredElements = append(filteredElements, element)
-		} else {
-			notAvailableElements = append(notAvailableElements, index)
-		}
-	}
-	songs := make([]SongData, len(filteredElements))
-	var wg *sync.WaitGroup = &sync.WaitGroup{}
+func playlistSet(playlistData *PlaylistData) setInfo {
+	return setInfo{url: playlistData.Url, title: playlistData.Title, author: playlistData.Author, trackCount: playlistData.TrackCount, artworkURL: playlistData.ArtworkURL}
+}
 
-	mutex := &sync.Mutex{} // declare a mutex
+func albumSet(albumData *AlbumData) setInfo {
+	return setInfo{url: albumData.Url, title: albumData.Title, author: albumData.Author, trackCount: albumData.TrackCount, artworkURL: albumData.ArtworkURL, album: true}
+}
 
-	for index, element := range elements {
-		wg.Add(1)
-		go func(element *rod.Element, index int, output *[]SongData, wg *sync.WaitGroup) {
-			mutex.Lock()
-			defer mutex.Unlock()
-
-			title, err := element.Element(TRACK_TITLE_QUERY)
-			if err != nil {
-				title = nil
-			}
-			url, err := element.Element(TRACK_TITLE_QUERY)
-			if err != nil {
+// DownloadPlaylist downloads every available track of a playlist.
+func (c *Client) DownloadPlaylist(ctx context.Context, playlistData *PlaylistData) error {
+	return c.downloadSet(ctx, playlistSet(playlistData), c.setDir(playlistData.Title, playlistData.Author))
+}
 
-				log.Panicln(err, " url ", index)
-			}
+// DownloadAlbum downloads every available track of an album.
+func (c *Client) DownloadAlbum(ctx context.Context, albumData *AlbumData) error {
+	return c.downloadSet(ctx, albumSet(albumData), c.setDir(albumData.Title, albumData.Author))
+}
 
-			song := SongData{
-				Title: func() string {
-					if title == nil {
-						return ""
-					}
-					return title.MustText()
-				}(),
-				Url:       SoundCloudBaseURL + *url.MustAttribute("href"),
-				Author:    albumData.Author,
-				Available: true,
-			}
-			(*output)[index] = song
-			wg.Done()
-		}(element, index, &songs, wg)
+// SearchSongsByTitle is a wrapper around Client.SearchSongs that uses a
+// client of its own, closed on return, and logs errors.
+func SearchSongsByTitle(searchString string) []SongData {
+	client := NewClient()
+	defer client.Close()
+	songs, err := client.SearchSongs(context.Background(), searchString)
+	if err != nil {
+		log.Println("failed to search songs", err)
 	}
-	wg.Wait()
-	triggerCloseBar <- struct{}{}
-	prepareBar.Close()
-	songsChunks := createChunks(&songs, 3)
+	return songs
+}
 
-	loadingBar := progressbar.NewOptions(
-		len(songs),
-		progressbar.OptionFullWidth(),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetDescription("Downloading"),
-		progressbar.OptionSetWriter(os.Stderr),
-		progressbar.OptionSetItsString(""),
-		progressbar.OptionSpinnerType(11),
-		progressbar.OptionClearOnFinish(),
-		progressbar.OptionShowCount(),
-	)
+// SearchPlaylistsByTitle is a wrapper around Client.SearchPlaylists that
+// uses a client of its own, closed on return, and logs errors.
+func SearchPlaylistsByTitle(searchString string) []PlaylistData {
+	client := NewClient()
+	defer client.Close()
+	playlists, err := client.SearchPlaylists(context.Background(), searchString)
+	if err != nil {
+		log.Println("failed to search playlists", err)
+	}
+	return playlists
+}
 
-	if len(notAvailableElements) > 0 {
-		fmt.Println(Colorize("yellow", "Warning: some songs won't be downloaded as they are not available!"))
-	}
-
-	finished := []int{}
-	for _, chunk := range songsChunks {
-		wg.Add(len(chunk))
-		for _, song := range chunk {
-			if song.Available {
-				go func(song SongData) {
-					DownloadTrack(&song, fmt.Sprintf("%s - %s", albumData.Title, albumData.Author))
-					finished = append(finished, 1)
-					loadingBar.Add(1)
-					wg.Done()
-				}(song)
-			} else {
-				wg.Done()
-			}
-		}
-		wg.Wait()
+// SearchAlbumsByTitle is a wrapper around Client.SearchAlbums that uses a
+// client of its own, closed on return, and logs errors.
+func SearchAlbumsByTitle(searchString string) []AlbumData {
+	client := NewClient()
+	defer client.Close()
+	albums, err := client.SearchAlbums(context.Background(), searchString)
+	if err != nil {
+		log.Println("failed to search albums", err)
 	}
+	return albums
+}
 
-	go func() {
-		for {
-			fmt.Printf("%d/%d \r", len(finished), len(songs))
-			time.Sleep(1 * time.Second)
-		}
-	}()
+// DownloadTrack is a wrapper around Client.DownloadTrack that uses a
+// client of its own, closed on return, and logs errors.
+func DownloadTrack(songData *SongData, parentDir string) {
+	client := NewClient()
+	defer client.Close()
+	if err := client.DownloadTrack(context.Background(), songData, parentDir); err != nil {
+		log.Println("failed to download track", err)
+	}
+}
+
+// DownloadPlaylist is a wrapper around Client.DownloadPlaylist that uses a
+// client of its own, closed on return, and logs errors.
+func DownloadPlaylist(playlistData *PlaylistData) {
+	client := NewClient()
+	defer client.Close()
+	if err := client.DownloadPlaylist(context.Background(), playlistData); err != nil {
+		log.Println("failed to download playlist", err)
+	}
+}
+
+// DownloadAlbum is a wrapper around Client.DownloadAlbum that uses a
+// client of its own, closed on return, and logs errors.
+func DownloadAlbum(albumData *AlbumData) {
+	client := NewClient()
+	defer client.Close()
+	if err := client.DownloadAlbum(context.Background(), albumData); err != nil {
+		log.Println("failed to download album", err)
+	}
 }
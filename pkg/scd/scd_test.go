@@ -0,0 +1,220 @@
+package scd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func staticClient() *Client {
+	return &Client{Fetcher: &StaticFetcher{Dir: "testdata"}}
+}
+
+func TestSearchSongsFixture(t *testing.T) {
+	songs, err := staticClient().SearchSongs(context.Background(), " night drive ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSearchSongs(t, songs)
+}
+
+func TestSearchSongsFixtureServer(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+	client := &Client{Fetcher: &StaticFetcher{BaseURL: server.URL}}
+
+	songs, err := client.SearchSongs(context.Background(), "night drive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSearchSongs(t, songs)
+}
+
+func assertSearchSongs(t *testing.T, songs []SongData) {
+	t.Helper()
+	want := []SongData{
+		{
+			Title:      "Night Drive",
+			Author:     "Synthwave Artist",
+			Url:        "https://soundcloud.com/synthwave-artist/night-drive",
+			Available:  true,
+			Genre:      "Synthwave",
+			Year:       2021,
+			Uploaded:   time.Date(2021, 6, 4, 18, 30, 0, 0, time.UTC),
+			ArtworkURL: "https://i1.sndcdn.com/artworks-000111-aaaaaa-large.jpg",
+		},
+		{
+			Title:  "Night Drive (Remix)",
+			Author: "Label Records",
+			Url:    "https://soundcloud.com/label-records/night-drive-remix",
+		},
+	}
+	if !reflect.DeepEqual(songs, want) {
+		t.Errorf("SearchSongs() =\n%+v\nwant\n%+v", songs, want)
+	}
+}
+
+func TestSearchPlaylistsFixture(t *testing.T) {
+	playlists, err := staticClient().SearchPlaylists(context.Background(), "night drive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The result without tracks is left out.
+	want := []PlaylistData{{
+		Title:      "Night Drives",
+		Author:     "Curator",
+		Url:        "https://soundcloud.com/curator/sets/night-drives",
+		TrackCount: 3,
+		ArtworkURL: "https://i1.sndcdn.com/artworks-000222-bbbbbb-large.jpg",
+	}}
+	if !reflect.DeepEqual(playlists, want) {
+		t.Errorf("SearchPlaylists() =\n%+v\nwant\n%+v", playlists, want)
+	}
+}
+
+func TestSearchAlbumsEmptyFixture(t *testing.T) {
+	albums, err := staticClient().SearchAlbums(context.Background(), "nothing at all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 0 {
+		t.Errorf("SearchAlbums() = %+v, want no results", albums)
+	}
+}
+
+func TestCollectSetTracksScraped(t *testing.T) {
+	set := setInfo{url: "https://soundcloud.com/artist/sets/long-album", title: "Long Album", author: "Artist", trackCount: 3, album: true}
+	songs, notAvailable, err := staticClient().setTracks(context.Background(), set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notAvailable != 1 {
+		t.Errorf("notAvailable = %d, want 1", notAvailable)
+	}
+	artwork := "https://i1.sndcdn.com/artworks-000333-cccccc-t500x500.jpg"
+	want := []SongData{
+		{
+			Title: "Opening", Url: "https://soundcloud.com/artist/opening", Author: "Artist", Available: true,
+			ArtworkURL: artwork, Playlist: "Long Album", Album: "Long Album", AlbumArtist: "Artist", TrackNumber: 1, TrackTotal: 3,
+		},
+		{
+			Title: "Closing", Url: "https://soundcloud.com/artist/closing", Author: "Artist", Available: true,
+			ArtworkURL: artwork, Playlist: "Long Album", Album: "Long Album", AlbumArtist: "Artist", TrackNumber: 3, TrackTotal: 3,
+		},
+	}
+	if !reflect.DeepEqual(songs, want) {
+		t.Errorf("setTracks() =\n%+v\nwant\n%+v", songs, want)
+	}
+}
+
+func TestCollectSetTracksHydrated(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+	client := &Client{Fetcher: &StaticFetcher{BaseURL: server.URL}}
+
+	set := setInfo{url: "https://soundcloud.com/artist/sets/mixtape", title: "Mixtape", author: "Artist", trackCount: 2}
+	songs, notAvailable, err := client.setTracks(context.Background(), set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notAvailable != 1 {
+		t.Errorf("notAvailable = %d, want 1", notAvailable)
+	}
+	want := []SongData{{
+		ID:          401,
+		Title:       "First",
+		Author:      "Friend",
+		Url:         "https://soundcloud.com/friend/first",
+		Available:   true,
+		Genre:       "House",
+		Year:        2022,
+		Uploaded:    time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC),
+		ArtworkURL:  "https://i1.sndcdn.com/artworks-000444-dddddd-large.jpg",
+		Playlist:    "Mixtape",
+		Album:       "Mixtape",
+		TrackNumber: 1,
+		TrackTotal:  2,
+		Duration:    200 * time.Second,
+	}}
+	if !reflect.DeepEqual(songs, want) {
+		t.Errorf("setTracks() =\n%+v\nwant\n%+v", songs, want)
+	}
+}
+
+func TestSearchQueryEscaped(t *testing.T) {
+	const query = "rock & roll #1 + 50% off"
+	tests := []struct {
+		path   string
+		search func(client *Client) error
+	}{
+		{"/search/sounds", func(client *Client) error {
+			_, err := client.SearchSongs(context.Background(), " "+query+" ")
+			return err
+		}},
+		{"/search/sets", func(client *Client) error {
+			_, err := client.SearchPlaylists(context.Background(), query)
+			return err
+		}},
+		{"/search/albums", func(client *Client) error {
+			_, err := client.SearchAlbums(context.Background(), query)
+			return err
+		}},
+	}
+	for _, test := range tests {
+		fetcher := &failingFetcher{err: errors.New("offline")}
+		client := &Client{Fetcher: fetcher, Retry: RetryPolicy{MaxAttempts: 1}, Progress: io.Discard}
+		if err := test.search(client); err == nil {
+			t.Fatalf("search of %s succeeded", test.path)
+		}
+		if len(fetcher.opened) != 1 {
+			t.Fatalf("opened %q, want one search page", fetcher.opened)
+		}
+		u, err := url.Parse(fetcher.opened[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != test.path || u.Query().Get("q") != query || u.Fragment != "" {
+			t.Errorf("opened %s, want %s searching for %q", fetcher.opened[0], test.path, query)
+		}
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	// Nothing may reach the standard streams.
+	stdout, stderr := os.Stdout, os.Stderr
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout, os.Stderr = writer, writer
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	progress := &bytes.Buffer{}
+	client := staticClient()
+	client.Progress = progress
+	if _, err := client.SearchPlaylists(context.Background(), "night drive"); err != nil {
+		t.Fatal(err)
+	}
+	client.warnNotAvailable()
+
+	os.Stdout, os.Stderr = stdout, stderr
+	writer.Close()
+	leaked, _ := io.ReadAll(reader)
+	if len(leaked) != 0 {
+		t.Errorf("wrote %q to the standard streams", leaked)
+	}
+	for _, want := range []string{"Searching for playlists", "not available"} {
+		if !strings.Contains(progress.String(), want) {
+			t.Errorf("progress output %q does not contain %q", progress.String(), want)
+		}
+	}
+}
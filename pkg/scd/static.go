@@ -0,0 +1,179 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// StaticFetcher is a Fetcher that serves saved HTML instead of driving a
+// browser, so the selectors can be exercised without network access.
+//
+// A page url is mapped to a fixture name made of its path without the
+// leading slash and, when present, "_" followed by the escaped query, e.g.
+// "https://soundcloud.com/search/sounds?q=foo" becomes
+// "search/sounds_q%3Dfoo". With Dir set, the fixture is read from
+// Dir/<name>.html. Otherwise it is fetched from BaseURL/<name>.html, which
+// suits an httptest server serving a fixture directory.
+type StaticFetcher struct {
+	Dir     string
+	BaseURL string
+	// HTTPClient is used when BaseURL is set. http.DefaultClient is used
+	// when nil.
+	HTTPClient *http.Client
+	// Streams maps track page urls to the HLS playlist urls returned by
+	// StreamURL.
+	Streams map[string]string
+}
+
+func fixtureName(pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	name := strings.Trim(u.Path, "/")
+	if name == "" {
+		name = "index"
+	}
+	if u.RawQuery != "" {
+		name += "_" + url.QueryEscape(u.RawQuery)
+	}
+	return name + ".html", nil
+}
+
+func (f *StaticFetcher) openFixture(ctx context.Context, name string) (io.ReadCloser, error) {
+	if f.Dir != "" {
+		return os.Open(filepath.Join(f.Dir, filepath.FromSlash(name)))
+	}
+	if f.BaseURL == "" {
+		return nil, fmt.Errorf("static fetcher has neither Dir nor BaseURL")
+	}
+
+	// The name is escaped, as the "%" of an escaped query is part of it.
+	path := (&url.URL{Path: name}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(f.BaseURL, "/")+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(resp, fmt.Errorf("unexpected status %s for fixture %s", resp.Status, name))
+	}
+	return resp.Body, nil
+}
+
+func (f *StaticFetcher) Open(ctx context.Context, pageURL string) (Page, error) {
+	name, err := fixtureName(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := f.openFixture(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open fixture for %s: %w", pageURL, err)
+	}
+	defer body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse fixture for %s: %w", pageURL, err)
+	}
+	return &staticPage{doc.Selection}, nil
+}
+
+func (f *StaticFetcher) StreamURL(ctx context.Context, pageURL string) (string, error) {
+	if streamURL, ok := f.Streams[pageURL]; ok {
+		return streamURL, nil
+	}
+	return "", ErrNoStream
+}
+
+type staticPage struct {
+	sel *goquery.Selection
+}
+
+func (p *staticPage) Element(selector string) (Element, error) {
+	return (&staticElement{p.sel}).Element(selector)
+}
+
+func (p *staticPage) Elements(selector string) ([]Element, error) {
+	return (&staticElement{p.sel}).Elements(selector)
+}
+
+func (p *staticPage) WaitElement(selectors ...string) error {
+	for _, selector := range selectors {
+		if p.sel.Find(selector).Length() > 0 {
+			return nil
+		}
+	}
+	return ErrElementNotFound
+}
+
+// ScrollUntil is a no-op: a saved page contains everything it will ever
+// show.
+func (p *staticPage) ScrollUntil(selector string, count int) error {
+	return nil
+}
+
+func (p *staticPage) Hydration() ([]byte, error) {
+	scripts := p.sel.Find("script")
+	for i := range scripts.Nodes {
+		data, err := extractHydration([]byte(scripts.Eq(i).Text()))
+		if !errors.Is(err, ErrNoHydration) {
+			return data, err
+		}
+	}
+	return nil, ErrNoHydration
+}
+
+func (p *staticPage) Close() error {
+	return nil
+}
+
+type staticElement struct {
+	sel *goquery.Selection
+}
+
+func (e *staticElement) Element(selector string) (Element, error) {
+	found := e.sel.Find(selector).First()
+	if found.Length() == 0 {
+		return nil, ErrElementNotFound
+	}
+	return &staticElement{found}, nil
+}
+
+func (e *staticElement) Elements(selector string) ([]Element, error) {
+	output := []Element{}
+	e.sel.Find(selector).Each(func(_ int, s *goquery.Selection) {
+		output = append(output, &staticElement{s})
+	})
+	return output, nil
+}
+
+func (e *staticElement) Text() (string, error) {
+	return strings.TrimSpace(e.sel.Text()), nil
+}
+
+func (e *staticElement) Attribute(name string) (string, bool, error) {
+	value, ok := e.sel.Attr(name)
+	return value, ok, nil
+}
+
+func (e *staticElement) Expand(selector string) error {
+	return nil
+}
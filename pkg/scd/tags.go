@@ -0,0 +1,217 @@
+package scd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// vorbisComments returns the set fields of tags as Vorbis comments, as
+// used in OpusTags headers.
+func vorbisComments(tags *Tags) []string {
+	comments := []string{}
+	add := func(name, value string) {
+		if value != "" {
+			comments = append(comments, name+"="+value)
+		}
+	}
+	add("TITLE", tags.Title)
+	add("ARTIST", tags.Artist)
+	add("ALBUM", tags.Album)
+	add("ALBUMARTIST", tags.AlbumArtist)
+	if tags.TrackNumber > 0 {
+		add("TRACKNUMBER", strconv.Itoa(tags.TrackNumber))
+	}
+	if tags.TrackTotal > 0 {
+		add("TRACKTOTAL", strconv.Itoa(tags.TrackTotal))
+	}
+	if tags.Year > 0 {
+		add("DATE", strconv.Itoa(tags.Year))
+	}
+	add("GENRE", tags.Genre)
+	add("URL", tags.URL)
+	if tags.Artwork != nil {
+		comments = append(comments, vorbisPictureComment(tags.Artwork))
+	}
+	return comments
+}
+
+func mp4BoxBytes(kind string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	box := binary.BigEndian.AppendUint32(make([]byte, 0, size), uint32(size))
+	box = append(box, kind...)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// mp4MetadataItem builds an iTunes metadata item holding a value of the
+// given well-known data type.
+func mp4MetadataItem(kind string, dataType uint32, value []byte) []byte {
+	header := binary.BigEndian.AppendUint32(nil, dataType)
+	header = append(header, 0, 0, 0, 0)
+	return mp4BoxBytes(kind, mp4BoxBytes("data", header, value))
+}
+
+// mp4MetadataBox builds a meta box with an iTunes item list for tags.
+func mp4MetadataBox(tags *Tags) []byte {
+	const utf8Type = 1
+	items := [][]byte{}
+	text := func(kind, value string) {
+		if value != "" {
+			items = append(items, mp4MetadataItem(kind, utf8Type, []byte(value)))
+		}
+	}
+	text("\xa9nam", tags.Title)
+	text("\xa9ART", tags.Artist)
+	text("\xa9alb", tags.Album)
+	text("aART", tags.AlbumArtist)
+	if tags.TrackNumber > 0 {
+		trkn := []byte{0, 0}
+		trkn = binary.BigEndian.AppendUint16(trkn, uint16(tags.TrackNumber))
+		trkn = binary.BigEndian.AppendUint16(trkn, uint16(tags.TrackTotal))
+		items = append(items, mp4MetadataItem("trkn", 0, append(trkn, 0, 0)))
+	}
+	if tags.Year > 0 {
+		text("\xa9day", strconv.Itoa(tags.Year))
+	}
+	text("\xa9gen", tags.Genre)
+	text("\xa9cmt", tags.URL)
+	if tags.Artwork != nil {
+		items = append(items, mp4CoverItem(tags.Artwork))
+	}
+
+	hdlr := mp4BoxBytes("hdlr", make([]byte, 8), []byte("mdirappl"), make([]byte, 9))
+	return mp4BoxBytes("meta", make([]byte, 4), hdlr, mp4BoxBytes("ilst", items...))
+}
+
+// mp4WithMetadata returns buf with a metadata box added to the user data of
+// its moov box.
+func mp4WithMetadata(buf []byte, tags *Tags) ([]byte, error) {
+	boxes, err := readMP4Boxes(buf)
+	if err != nil {
+		return nil, err
+	}
+	output := make([]byte, 0, len(buf)+1024)
+	found := false
+	for i, box := range boxes {
+		end := len(buf)
+		if i+1 < len(boxes) {
+			end = boxes[i+1].offset
+		}
+		if box.kind != "moov" || found {
+			output = append(output, buf[box.offset:end]...)
+			continue
+		}
+		found = true
+
+		children, err := readMP4Boxes(box.data)
+		if err != nil {
+			return nil, err
+		}
+		payload := [][]byte{}
+		hasUserData := false
+		for j, child := range children {
+			childEnd := len(box.data)
+			if j+1 < len(children) {
+				childEnd = children[j+1].offset
+			}
+			if child.kind == "udta" {
+				hasUserData = true
+				payload = append(payload, mp4BoxBytes("udta", child.data, mp4MetadataBox(tags)))
+				continue
+			}
+			payload = append(payload, box.data[child.offset:childEnd])
+		}
+		if !hasUserData {
+			payload = append(payload, mp4BoxBytes("udta", mp4MetadataBox(tags)))
+		}
+		output = append(output, mp4BoxBytes("moov", payload...)...)
+	}
+	if !found {
+		return nil, errors.New("no moov box")
+	}
+	return output, nil
+}
+
+// oggTagger copies an Ogg Opus stream, replacing its OpusTags header. The
+// pages after the header are renumbered when the new header needs a
+// different number of pages.
+type oggTagger struct {
+	tags    *Tags
+	pending []byte
+	// state is 0 before the identification header, 1 while reading the
+	// comment header and 2 afterwards.
+	state     int
+	serial    uint32
+	inTags    bool
+	tagsStart uint32
+	// shift is added to the sequence number of the pages after the
+	// comment header.
+	shift int64
+}
+
+func (t *oggTagger) write(w io.Writer, data []byte) error {
+	t.pending = append(t.pending, data...)
+	for {
+		page, length, err := readOggPage(t.pending)
+		if err != nil {
+			return err
+		}
+		if length == 0 {
+			return nil
+		}
+		if err := t.writePage(w, page); err != nil {
+			return err
+		}
+		t.pending = t.pending[length:]
+	}
+}
+
+func (t *oggTagger) writePage(w io.Writer, page *oggPage) error {
+	switch t.state {
+	case 0:
+		t.serial = page.serial
+		t.state = 1
+		_, err := w.Write(page.bytes())
+		return err
+	case 1:
+		if page.serial != t.serial {
+			return errors.New("interleaved Ogg streams are not supported")
+		}
+		if !t.inTags {
+			t.tagsStart = page.sequence
+			t.inTags = true
+		}
+		// The comment header ends the page it finishes on; until then its
+		// pages are dropped.
+		if len(page.lacing) == 0 || page.lacing[len(page.lacing)-1] == 255 {
+			return nil
+		}
+		writer := newOggWriter(t.serial)
+		writer.started = true
+		writer.sequence = t.tagsStart
+		if err := writer.writeHeaderPacket(w, opusTags(vorbisComments(t.tags))); err != nil {
+			return err
+		}
+		t.shift = int64(writer.sequence) - int64(page.sequence) - 1
+		t.state = 2
+		return nil
+	default:
+		page.sequence = uint32(int64(page.sequence) + t.shift)
+		_, err := w.Write(page.bytes())
+		return err
+	}
+}
+
+func (t *oggTagger) finish() error {
+	if len(t.pending) > 0 {
+		return errors.New("truncated Ogg page")
+	}
+	return nil
+}
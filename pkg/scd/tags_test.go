@@ -0,0 +1,337 @@
+package scd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testTags = &Tags{
+	Title:       "Nuit à Tōkyō — 東京",
+	Artist:      "Artist",
+	Album:       "Album",
+	AlbumArtist: "Album Artist",
+	TrackNumber: 3,
+	TrackTotal:  12,
+	Year:        2021,
+	Genre:       "Ambient",
+	URL:         "https://soundcloud.com/artist/track",
+	// The artwork makes the tag larger than 127 bytes, so its size uses
+	// several synchsafe bytes.
+	Artwork: &Artwork{MIME: "image/png", Data: bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 100)},
+}
+
+func unsyncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+func TestSyncsafe(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0, 0, 0, 0}},
+		{127, []byte{0, 0, 0, 0x7f}},
+		{128, []byte{0, 0, 1, 0}},
+		{255, []byte{0, 0, 1, 0x7f}},
+		{0x0fffffff, []byte{0x7f, 0x7f, 0x7f, 0x7f}},
+	}
+	for _, test := range tests {
+		if got := syncsafe(test.n); !bytes.Equal(got, test.want) || unsyncsafe(got) != test.n {
+			t.Errorf("syncsafe(%d) = %x, want %x", test.n, got, test.want)
+		}
+	}
+}
+
+// readID3Tag parses an ID3v2.4 tag into its frames.
+func readID3Tag(t *testing.T, tag []byte) map[string][]byte {
+	t.Helper()
+	if len(tag) < 10 || string(tag[:5]) != "ID3\x04\x00" || tag[5] != 0 {
+		t.Fatalf("not an ID3v2.4 tag without flags: %x", tag[:min(len(tag), 10)])
+	}
+	if size := unsyncsafe(tag[6:10]); size != len(tag)-10 {
+		t.Fatalf("tag size = %d, want %d", size, len(tag)-10)
+	}
+	frames := map[string][]byte{}
+	for rest := tag[10:]; len(rest) > 0; {
+		if len(rest) < 10 {
+			t.Fatalf("truncated frame header %x", rest)
+		}
+		for _, b := range rest[4:8] {
+			if b&0x80 != 0 {
+				t.Fatalf("frame %s size %x is not synchsafe", rest[:4], rest[4:8])
+			}
+		}
+		size := unsyncsafe(rest[4:8])
+		if 10+size > len(rest) {
+			t.Fatalf("frame %s of %d bytes overruns the tag", rest[:4], size)
+		}
+		frames[string(rest[:4])] = rest[10 : 10+size]
+		rest = rest[10+size:]
+	}
+	return frames
+}
+
+func TestID3v2Tag(t *testing.T) {
+	tag := id3v2Tag(testTags)
+	if id3Length(tag) != len(tag) {
+		t.Errorf("id3Length() = %d, want %d", id3Length(tag), len(tag))
+	}
+	frames := readID3Tag(t, tag)
+
+	text := map[string]string{
+		"TIT2": testTags.Title,
+		"TPE1": "Artist",
+		"TALB": "Album",
+		"TPE2": "Album Artist",
+		"TRCK": "3/12",
+		"TDRC": "2021",
+		"TCON": "Ambient",
+	}
+	for id, want := range text {
+		// Text frames are UTF-8, marked by encoding byte 3.
+		if got := frames[id]; len(got) == 0 || got[0] != 0x03 || string(got[1:]) != want {
+			t.Errorf("%s = %q, want %q in UTF-8", id, got, want)
+		}
+	}
+	if got := string(frames["WOAS"]); got != testTags.URL {
+		t.Errorf("WOAS = %q, want %q", got, testTags.URL)
+	}
+
+	// APIC: encoding, mime type, picture type 3 (front cover), empty
+	// description, data.
+	apic := append([]byte("\x03image/png\x00\x03\x00"), testTags.Artwork.Data...)
+	if !bytes.Equal(frames["APIC"], apic) {
+		t.Errorf("APIC = %x\nwant %x", frames["APIC"], apic)
+	}
+	if len(frames) != len(text)+2 {
+		t.Errorf("tag has %d frames, want %d", len(frames), len(text)+2)
+	}
+
+	// Unset fields get no frame.
+	frames = readID3Tag(t, id3v2Tag(&Tags{Title: "Title", TrackNumber: 4}))
+	if len(frames) != 2 || string(frames["TRCK"]) != "\x034" {
+		t.Errorf("frames = %q, want TIT2 and TRCK 4", frames)
+	}
+}
+
+// mp4Items returns the iTunes metadata items of an MP4 file by name, with
+// the type and value of their data box.
+func mp4Items(t *testing.T, file []byte) map[string][]byte {
+	t.Helper()
+	meta, err := findMP4Box(file, "moov", "udta", "meta")
+	if err != nil || meta == nil {
+		t.Fatalf("no moov/udta/meta box: %v", err)
+	}
+	// meta is a full box.
+	children, err := readMP4Boxes(meta.data[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[0].kind != "hdlr" || children[1].kind != "ilst" {
+		t.Fatalf("meta holds %+v, want hdlr and ilst", children)
+	}
+	if handler := string(children[0].data[8:12]); handler != "mdir" {
+		t.Errorf("handler = %q, want mdir", handler)
+	}
+	items, err := readMP4Boxes(children[1].data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string][]byte{}
+	for _, item := range items {
+		data, err := readMP4Boxes(item.data)
+		if err != nil || len(data) != 1 || data[0].kind != "data" || len(data[0].data) < 8 {
+			t.Fatalf("item %q has no single data box: %v", item.kind, err)
+		}
+		// The data box holds a type, a locale and the value.
+		values[item.kind] = data[0].data
+	}
+	return values
+}
+
+func TestMP4Metadata(t *testing.T) {
+	text := func(value string) []byte {
+		return append([]byte{0, 0, 0, 1, 0, 0, 0, 0}, value...)
+	}
+	want := map[string][]byte{
+		"\xa9nam": text(testTags.Title),
+		"\xa9ART": text("Artist"),
+		"\xa9alb": text("Album"),
+		"aART":    text("Album Artist"),
+		"trkn":    {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3, 0, 12, 0, 0},
+		"\xa9day": text("2021"),
+		"\xa9gen": text("Ambient"),
+		"\xa9cmt": text(testTags.URL),
+		"covr":    append([]byte{0, 0, 0, 14, 0, 0, 0, 0}, testTags.Artwork.Data...),
+	}
+
+	init := mp4Init(44100, audioSampleEntry("mp4a"))
+	fragment := mp4Fragment(1, 1024, []byte("frame"))
+	tests := []struct {
+		name string
+		init []byte
+	}{
+		{"without user data", init},
+		{"with user data", mp4WithUserData(t, init, mp4BoxBytes("\xa9too", []byte("encoder")))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tagged, err := mp4WithMetadata(append(bytes.Clone(test.init), fragment...), testTags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mp4Items(t, tagged); !reflect.DeepEqual(got, want) {
+				t.Errorf("items =\n%q\nwant\n%q", got, want)
+			}
+			if !bytes.HasSuffix(tagged, fragment) || !bytes.HasPrefix(tagged, test.init[:bytes.Index(test.init, []byte("moov"))-4]) {
+				t.Error("the boxes around moov were not kept")
+			}
+			if entry, _, err := mp4SampleEntry(tagged); err != nil || entry != "mp4a" {
+				t.Errorf("sample entry = %q, %v after tagging", entry, err)
+			}
+			udta, _ := findMP4Box(tagged, "moov", "udta")
+			if existing, _ := findMP4Box(test.init, "moov", "udta"); existing != nil && !bytes.HasPrefix(udta.data, existing.data) {
+				t.Error("the existing user data was dropped")
+			}
+		})
+	}
+
+	if _, err := mp4WithMetadata(fragment, testTags); err == nil {
+		t.Error("mp4WithMetadata() accepted a fragment without moov")
+	}
+}
+
+// mp4WithUserData returns init with a udta box holding payload appended to
+// its moov box.
+func mp4WithUserData(t *testing.T, init []byte, payload []byte) []byte {
+	t.Helper()
+	boxes, err := readMP4Boxes(init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := []byte{}
+	for _, box := range boxes {
+		if box.kind == "moov" {
+			output = append(output, mp4BoxBytes("moov", box.data, mp4BoxBytes("udta", payload))...)
+			continue
+		}
+		output = append(output, mp4BoxBytes(box.kind, box.data)...)
+	}
+	return output
+}
+
+// readOpusTags parses an OpusTags packet into its vendor and comments.
+func readOpusTags(t *testing.T, packet []byte) (string, []string) {
+	t.Helper()
+	if !bytes.HasPrefix(packet, []byte("OpusTags")) {
+		t.Fatalf("packet does not start with OpusTags: %q", packet[:min(len(packet), 8)])
+	}
+	rest := packet[8:]
+	next := func() []byte {
+		length := binary.LittleEndian.Uint32(rest)
+		value := rest[4 : 4+length]
+		rest = rest[4+length:]
+		return value
+	}
+	vendor := string(next())
+	count := binary.LittleEndian.Uint32(rest)
+	rest = rest[4:]
+	comments := []string{}
+	for i := uint32(0); i < count; i++ {
+		comments = append(comments, string(next()))
+	}
+	if len(rest) != 0 {
+		t.Errorf("%d bytes after the comments", len(rest))
+	}
+	return vendor, comments
+}
+
+func TestVorbisComments(t *testing.T) {
+	vendor, comments := readOpusTags(t, opusTags(vorbisComments(testTags)))
+	if vendor != "scd" {
+		t.Errorf("vendor = %q", vendor)
+	}
+	want := []string{
+		"TITLE=" + testTags.Title, "ARTIST=Artist", "ALBUM=Album", "ALBUMARTIST=Album Artist",
+		"TRACKNUMBER=3", "TRACKTOTAL=12", "DATE=2021", "GENRE=Ambient", "URL=" + testTags.URL,
+	}
+	if len(comments) != len(want)+1 || !reflect.DeepEqual(comments[:len(want)], want) {
+		t.Fatalf("comments = %q, want %q and a picture", comments, want)
+	}
+
+	// METADATA_BLOCK_PICTURE holds a base64 FLAC picture block.
+	encoded, ok := strings.CutPrefix(comments[len(want)], "METADATA_BLOCK_PICTURE=")
+	if !ok {
+		t.Fatalf("last comment = %.40q, want a picture", comments[len(want)])
+	}
+	block, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	picture := binary.BigEndian.AppendUint32(nil, 3)
+	picture = binary.BigEndian.AppendUint32(picture, 9)
+	picture = append(picture, "image/png"...)
+	picture = append(picture, make([]byte, 20)...)
+	picture = binary.BigEndian.AppendUint32(picture, uint32(len(testTags.Artwork.Data)))
+	picture = append(picture, testTags.Artwork.Data...)
+	if !bytes.Equal(block, picture) {
+		t.Errorf("picture block = %x\nwant %x", block, picture)
+	}
+}
+
+func TestOggTagger(t *testing.T) {
+	// An Opus stream with an empty comment header, followed by two audio
+	// pages.
+	stream := &bytes.Buffer{}
+	writer := newOggWriter(9)
+	writer.writeHeaderPacket(stream, []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00"))
+	writer.writeHeaderPacket(stream, opusTags(nil))
+	writer.writePacket(stream, []byte{0xfc, 1}, 960)
+	writer.flush(stream, 0)
+	writer.writePacket(stream, []byte{0xfc, 2}, 1920)
+	writer.close(stream)
+
+	tests := []struct {
+		name     string
+		tags     *Tags
+		tagPages int
+	}{
+		{"small header", &Tags{Title: "Title", Artist: "Artist"}, 1},
+		// Artwork larger than a page spreads the header over several.
+		{"header over several pages", &Tags{Title: "Title", Artwork: &Artwork{MIME: "image/jpeg", Data: bytes.Repeat([]byte{0xff}, 80000)}}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The stream arrives in arbitrary chunks.
+			data := stream.Bytes()
+			mux, output := muxChunks(t, [][]byte{data[:40], data[40:100], data[100:]}, "", test.tags)
+			if mux.ext() != "opus" {
+				t.Errorf("ext() = %s, want opus", mux.ext())
+			}
+
+			pages := readOggPages(t, output)
+			if len(pages) != 3+test.tagPages {
+				t.Fatalf("wrote %d pages, want %d", len(pages), 3+test.tagPages)
+			}
+			header := []byte{}
+			for index, page := range pages {
+				if page.sequence != uint32(index) || page.serial != 9 {
+					t.Errorf("page %d has sequence %d and serial %d", index, page.sequence, page.serial)
+				}
+				if index >= 1 && index <= test.tagPages {
+					header = append(header, page.body...)
+				}
+			}
+			if _, comments := readOpusTags(t, header); !reflect.DeepEqual(comments, vorbisComments(test.tags)) {
+				t.Errorf("comments = %.80q", comments)
+			}
+			if !bytes.Equal(pages[0].body, pages[0].body[:19]) || pages[len(pages)-1].flags&oggEOS == 0 || pages[len(pages)-1].granule != 1920 {
+				t.Error("the pages around the comment header were not kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package scd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// templateFields are the fields an OutputTemplate can refer to.
+var templateFields = map[string]bool{
+	"artist":       true,
+	"title":        true,
+	"album":        true,
+	"album_artist": true,
+	"playlist":     true,
+	"index":        true,
+	"track_total":  true,
+	"id":           true,
+	"upload_date":  true,
+	"year":         true,
+	"genre":        true,
+	"ext":          true,
+}
+
+// numericFields are the fields that accept a width such as {index:02}.
+var numericFields = map[string]bool{"index": true, "track_total": true, "id": true, "year": true}
+
+// OutputTemplate lays out the path of each download relative to the
+// output directory, e.g. "{artist}/{album}/{index:02} - {title}.{ext}".
+// Fields are written as {name} or, for numbers, {name:width} where a
+// leading zero pads with zeros; "{{" and "}}" are literal braces. A "/"
+// in the template starts a directory, while the values of fields never do.
+type OutputTemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+// templatePart is a literal, or a field when field is set.
+type templatePart struct {
+	literal string
+	field   string
+	width   int
+	zero    bool
+}
+
+// ParseOutputTemplate parses a template. ".{ext}" is appended when the
+// template does not use {ext}, which may only appear in the file name.
+func ParseOutputTemplate(template string) (*OutputTemplate, error) {
+	t := &OutputTemplate{raw: template}
+	literal := strings.Builder{}
+	for i := 0; i < len(template); i++ {
+		switch {
+		case strings.HasPrefix(template[i:], "{{"):
+			literal.WriteByte('{')
+			i++
+		case strings.HasPrefix(template[i:], "}}"):
+			literal.WriteByte('}')
+			i++
+		case template[i] == '}':
+			return nil, fmt.Errorf("invalid output template %q: unmatched }", template)
+		case template[i] == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid output template %q: unclosed {", template)
+			}
+			part, err := parseTemplateField(template[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid output template %q: %w", template, err)
+			}
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, part)
+			i += end
+		default:
+			literal.WriteByte(template[i])
+		}
+	}
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: literal.String()})
+	}
+	usesExt := false
+	for _, part := range t.parts {
+		if part.field == "ext" {
+			usesExt = true
+		} else if usesExt && strings.Contains(part.literal, "/") {
+			return nil, fmt.Errorf("invalid output template %q: {ext} must be in the file name", template)
+		}
+	}
+	if !usesExt {
+		t.parts = append(t.parts, templatePart{literal: "."}, templatePart{field: "ext"})
+	}
+	if strings.HasPrefix(template, "/") || strings.HasSuffix(template, "/") {
+		return nil, fmt.Errorf("invalid output template %q: must be a relative file path", template)
+	}
+	for _, name := range strings.Split(template, "/") {
+		if name == "." || name == ".." {
+			return nil, fmt.Errorf("invalid output template %q: must not contain %q", template, name)
+		}
+	}
+	return t, nil
+}
+
+func parseTemplateField(field string) (templatePart, error) {
+	name, spec, hasSpec := strings.Cut(field, ":")
+	if !templateFields[name] {
+		return templatePart{}, fmt.Errorf("unknown field {%s}", field)
+	}
+	part := templatePart{field: name}
+	if hasSpec {
+		width, err := strconv.Atoi(spec)
+		if !numericFields[name] || err != nil || width < 0 {
+			return templatePart{}, fmt.Errorf("invalid width in {%s}", field)
+		}
+		part.width = width
+		part.zero = strings.HasPrefix(spec, "0")
+	}
+	return part, nil
+}
+
+// String returns the template as it was parsed.
+func (t *OutputTemplate) String() string {
+	return t.raw
+}
+
+// render returns the path of song relative to the output directory, using
+// the native path separator. Every directory and file name in it is
+// cleaned, and empty directory names are left out.
+func (t *OutputTemplate) render(song *SongData, ext string, ascii bool) string {
+	path := strings.Builder{}
+	for _, part := range t.parts {
+		if part.field == "" {
+			path.WriteString(part.literal)
+			continue
+		}
+		path.WriteString(templateValue(song, part, ext))
+	}
+
+	names := strings.Split(path.String(), "/")
+	cleaned := []string{}
+	for _, name := range names[:len(names)-1] {
+		if name = truncateName(cleanName(name, ascii), maxNameBytes); name != "" {
+			cleaned = append(cleaned, name)
+		}
+	}
+	file := names[len(names)-1]
+	if ext != "" {
+		file = strings.TrimSuffix(file, "."+ext)
+	}
+	cleaned = append(cleaned, fileName(file, ext, ascii))
+	return filepath.Join(cleaned...)
+}
+
+// templateValue formats a field of song. Path separators in values are
+// replaced, so a field never adds a directory.
+func templateValue(song *SongData, part templatePart, ext string) string {
+	number := -1
+	value := ""
+	switch part.field {
+	case "artist":
+		value = song.Author
+	case "title":
+		value = song.Title
+	case "album":
+		value = song.Album
+	case "album_artist":
+		value = song.AlbumArtist
+	case "playlist":
+		value = song.Playlist
+	case "genre":
+		value = song.Genre
+	case "upload_date":
+		if !song.Uploaded.IsZero() {
+			value = song.Uploaded.Format("2006-01-02")
+		}
+	case "ext":
+		value = ext
+	case "index":
+		number = song.TrackNumber
+	case "track_total":
+		number = song.TrackTotal
+	case "year":
+		number = song.Year
+	case "id":
+		if song.ID != 0 {
+			value = strconv.FormatInt(song.ID, 10)
+		}
+	}
+	if number > 0 {
+		value = strconv.Itoa(number)
+	}
+	if value != "" && part.width > len(value) {
+		pad := " "
+		if part.zero {
+			pad = "0"
+		}
+		value = strings.Repeat(pad, part.width-len(value)) + value
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(value)
+}
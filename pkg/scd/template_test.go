@@ -0,0 +1,113 @@
+package scd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputTemplateRender(t *testing.T) {
+	song := SongData{
+		ID:          42,
+		Title:       "Title",
+		Author:      "Artist",
+		Album:       "Album",
+		AlbumArtist: "Album Artist",
+		Playlist:    "Mix",
+		Genre:       "Ambient",
+		Year:        2021,
+		Uploaded:    time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC),
+		TrackNumber: 3,
+		TrackTotal:  12,
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		// change adjusts the song before rendering.
+		change func(song *SongData)
+		ascii  bool
+		want   string
+	}{
+		{name: "artist", template: "{artist}", want: "Artist.mp3"},
+		{name: "title", template: "{title}", want: "Title.mp3"},
+		{name: "album", template: "{album}", want: "Album.mp3"},
+		{name: "album artist", template: "{album_artist}", want: "Album Artist.mp3"},
+		{name: "playlist", template: "{playlist}", want: "Mix.mp3"},
+		{name: "genre", template: "{genre}", want: "Ambient.mp3"},
+		{name: "index", template: "{index}", want: "3.mp3"},
+		{name: "index with zeros", template: "{index:02}", want: "03.mp3"},
+		{name: "index with spaces", template: "#{index:3}", want: "#  3.mp3"},
+		{name: "track total", template: "{track_total:03}", want: "012.mp3"},
+		{name: "id", template: "{id:05}", want: "00042.mp3"},
+		{name: "year", template: "{year}", want: "2021.mp3"},
+		{name: "upload date", template: "{upload_date}", want: "2021-03-04.mp3"},
+		{name: "ext", template: "{title}.{ext}", want: "Title.mp3"},
+		{name: "braces", template: "{{{title}}}", want: "{Title}.mp3"},
+		{name: "directories", template: "{artist}/{album}/{index:02} - {title}.{ext}", want: "Artist/Album/03 - Title.mp3"},
+
+		// Missing values expand to nothing, and empty directories are left
+		// out.
+		{name: "empty directory", template: "{artist}/{album}/{title}", change: func(song *SongData) { song.Album = "" }, want: "Artist/Title.mp3"},
+		{name: "missing number", template: "{index:02} - {title}", change: func(song *SongData) { song.TrackNumber = 0 }, want: "- Title.mp3"},
+		{name: "missing date", template: "{title} {upload_date}", change: func(song *SongData) { song.Uploaded = time.Time{} }, want: "Title.mp3"},
+		{name: "missing id", template: "{title} {id}", change: func(song *SongData) { song.ID = 0 }, want: "Title.mp3"},
+
+		// Names are cleaned after expansion.
+		{name: "reserved characters", template: "{artist}/{title}", change: func(song *SongData) { song.Author = `a:b`; song.Title = `what?*"` }, want: "a_b/what___.mp3"},
+		{name: "leading dot", template: "{title}", change: func(song *SongData) { song.Title = "..hidden" }, want: "_.hidden.mp3"},
+		{name: "trailing dots", template: "{album}/{title}", change: func(song *SongData) { song.Album = "Vol. 2..."; song.Title = "Name." }, want: "Vol. 2/Name.mp3"},
+		{name: "reserved name", template: "{title}", change: func(song *SongData) { song.Title = "CON" }, want: "_CON.mp3"},
+		{name: "blank directory", template: "{artist}/{title}", change: func(song *SongData) { song.Author = "  " }, want: "Title.mp3"},
+		{name: "long name", template: "{title}", change: func(song *SongData) { song.Title = strings.Repeat("a", 300) }, want: strings.Repeat("a", maxNameBytes) + ".mp3"},
+		{name: "ascii", template: "{artist}/{title}", change: func(song *SongData) { song.Author = "Björk"; song.Title = "Straße" }, ascii: true, want: "Bjork/Strasse.mp3"},
+		{name: "unicode", template: "{title}", change: func(song *SongData) { song.Title = "Café" }, want: "Café.mp3"},
+
+		// Path separators in values never add a directory.
+		{name: "slash in field", template: "{artist}/{title}", change: func(song *SongData) { song.Author = "AC/DC"; song.Title = "../up" }, want: "AC_DC/_._up.mp3"},
+		{name: "backslash in field", template: "{title}", change: func(song *SongData) { song.Title = `a\b` }, want: "a_b.mp3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := ParseOutputTemplate(test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			song := song
+			if test.change != nil {
+				test.change(&song)
+			}
+			if got := template.render(&song, "mp3", test.ascii); got != filepath.FromSlash(test.want) {
+				t.Errorf("render() = %q, want %q", got, filepath.FromSlash(test.want))
+			}
+		})
+	}
+}
+
+func TestParseOutputTemplateErrors(t *testing.T) {
+	tests := []string{
+		"{unknown}",
+		"{Title}",
+		"{title:02}",
+		"{index:x}",
+		"{index:-1}",
+		"{title",
+		"title}",
+		"/{artist}/{title}",
+		"{artist}/",
+		"../{title}",
+		"{artist}/./{title}",
+		"{ext}/{title}",
+	}
+	for _, template := range tests {
+		if _, err := ParseOutputTemplate(template); err == nil {
+			t.Errorf("ParseOutputTemplate(%q) succeeded", template)
+		}
+	}
+
+	template, err := ParseOutputTemplate("{artist} - {title}")
+	if err != nil || template.String() != "{artist} - {title}" {
+		t.Errorf("ParseOutputTemplate() = %v, %v", template, err)
+	}
+}
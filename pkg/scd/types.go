@@ -1,10 +1,35 @@
 package scd
 
+import "time"
+
 type SongData struct {
+	// ID is the SoundCloud track id, or zero when unknown.
+	ID        int64
 	Title     string
 	Author    string
 	Url       string
 	Available bool
+	Genre     string
+	Year      int
+	// Uploaded is when the track was uploaded, or zero when unknown.
+	Uploaded time.Time
+	// ArtworkURL is the cover of the track, or of the playlist or album
+	// it is downloaded from.
+	ArtworkURL string
+	// Playlist, Album, AlbumArtist, TrackNumber and TrackTotal are set
+	// when the track is downloaded as part of a playlist or album.
+	Playlist    string
+	Album       string
+	AlbumArtist string
+	TrackNumber int
+	TrackTotal  int
+	// Duration is the length of the track reported by SoundCloud, or zero
+	// when unknown. Downloads whose stream is much shorter or longer fail
+	// verification.
+	Duration time.Duration
+	// Secret is the token of a private track, without which the API does
+	// not return it, or empty.
+	Secret string
 }
 
 type PlaylistData struct {
@@ -12,6 +37,7 @@ type PlaylistData struct {
 	Author     string
 	Url        string
 	TrackCount int
+	ArtworkURL string
 }
 
 type AlbumData struct {
@@ -19,9 +45,44 @@ type AlbumData struct {
 	Author     string
 	Url        string
 	TrackCount int
+	ArtworkURL string
+}
+
+type UserData struct {
+	ID       int64
+	Username string
+	Url      string
 }
 
 type FetchResponse struct {
 	data  []byte
 	index int
 }
+
+// Tags is the metadata written into downloaded files.
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	TrackNumber int
+	TrackTotal  int
+	Year        int
+	Genre       string
+	URL         string
+	Artwork     *Artwork
+}
+
+func songTags(song *SongData) *Tags {
+	return &Tags{
+		Title:       song.Title,
+		Artist:      song.Author,
+		Album:       song.Album,
+		AlbumArtist: song.AlbumArtist,
+		TrackNumber: song.TrackNumber,
+		TrackTotal:  song.TrackTotal,
+		Year:        song.Year,
+		Genre:       song.Genre,
+		URL:         song.Url,
+	}
+}
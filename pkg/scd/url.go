@@ -0,0 +1,258 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URLKind is the kind of page a SoundCloud url points to.
+type URLKind string
+
+const (
+	URLTrack URLKind = "track"
+	// URLSet is a playlist or album; only the page tells which.
+	URLSet           URLKind = "set"
+	URLUser          URLKind = "user"
+	URLUserTracks    URLKind = "tracks"
+	URLUserAlbums    URLKind = "albums"
+	URLUserPlaylists URLKind = "playlists"
+	URLUserLikes     URLKind = "likes"
+	URLUserReposts   URLKind = "reposts"
+)
+
+// IsUser reports whether the url is a user page or one of its subpages.
+func (k URLKind) IsUser() bool {
+	switch k {
+	case URLUser, URLUserTracks, URLUserAlbums, URLUserPlaylists, URLUserLikes, URLUserReposts:
+		return true
+	}
+	return false
+}
+
+// URLRef is a SoundCloud url reduced to what it points to.
+type URLRef struct {
+	Kind URLKind
+	// User and Slug are the permalinks of the user and of the track or
+	// set. Both are empty for urls that only carry an ID.
+	User string
+	Slug string
+	// ID is set instead of User and Slug for api.soundcloud.com urls, as
+	// found in embedded players. Only the API can look those up.
+	ID int64
+	// Secret is the token of a private share link, e.g. "s-AbCdE".
+	Secret string
+	// URL is the canonical form of the url, without tracking parameters.
+	URL string
+}
+
+// userSubpages maps the user subpages to their kind.
+var userSubpages = map[string]URLKind{
+	"tracks":  URLUserTracks,
+	"albums":  URLUserAlbums,
+	"sets":    URLUserPlaylists,
+	"likes":   URLUserLikes,
+	"reposts": URLUserReposts,
+}
+
+// reservedPaths are the first path segments of soundcloud.com that are not
+// users.
+var reservedPaths = map[string]bool{
+	"charts": true, "discover": true, "feed": true, "jobs": true, "logout": true, "messages": true,
+	"mobile": true, "notifications": true, "pages": true, "people": true, "player": true,
+	"search": true, "settings": true, "signin": true, "stations": true, "stream": true,
+	"tags": true, "upload": true, "you": true,
+}
+
+// shortLinkHosts redirect to a soundcloud.com url.
+var shortLinkHosts = map[string]bool{
+	"on.soundcloud.com":     true,
+	"soundcloud.app.goo.gl": true,
+}
+
+// parseLink parses raw, adding a missing scheme, and lowercases its host.
+func parseLink(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// ParseURL turns a soundcloud.com, m.soundcloud.com, embedded player or
+// api.soundcloud.com url into a URLRef. Short links must be followed
+// first, see Client.ResolveURL.
+func ParseURL(raw string) (*URLRef, error) {
+	u, err := parseLink(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Host {
+	case "soundcloud.com", "www.soundcloud.com", "m.soundcloud.com":
+		return parseSitePath(raw, u.Path)
+	case "w.soundcloud.com":
+		// Embedded players carry the url they play in their query.
+		if embedded := u.Query().Get("url"); embedded != "" {
+			ref, err := ParseURL(embedded)
+			if err == nil && ref.ID != 0 && ref.Secret == "" && u.Query().Get("secret_token") != "" {
+				ref.Secret = u.Query().Get("secret_token")
+				ref.URL += "?secret_token=" + url.QueryEscape(ref.Secret)
+			}
+			return ref, err
+		}
+	case "api.soundcloud.com", "api-v2.soundcloud.com":
+		return parseAPIPath(raw, u)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+}
+
+// parseSitePath parses the path of a soundcloud.com url.
+func parseSitePath(raw, path string) (*URLRef, error) {
+	segments := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	if len(segments) == 0 || reservedPaths[segments[0]] {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+	}
+	ref := &URLRef{Kind: URLUser, User: segments[0]}
+	rest := segments[1:]
+
+	switch {
+	case len(rest) == 0:
+	case rest[0] == "sets" && len(rest) >= 2:
+		ref.Kind = URLSet
+		ref.Slug = rest[1]
+		if len(rest) >= 3 && isSecret(rest[2]) {
+			ref.Secret = rest[2]
+		}
+	case len(rest) == 1 && userSubpages[rest[0]] != "":
+		ref.Kind = userSubpages[rest[0]]
+	case rest[0] == "popular-tracks" || rest[0] == "followers" || rest[0] == "following" || rest[0] == "comments":
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+	default:
+		// Track pages have subpages such as /recommended or /likes of
+		// their own, which point to the same track.
+		ref.Kind = URLTrack
+		ref.Slug = rest[0]
+		if len(rest) >= 2 && isSecret(rest[1]) {
+			ref.Secret = rest[1]
+		}
+	}
+	ref.URL = ref.canonicalURL()
+	return ref, nil
+}
+
+// parseAPIPath parses the /tracks/<id>, /playlists/<id> and /users/<id>
+// urls of the API.
+func parseAPIPath(raw string, u *url.URL) (*URLRef, error) {
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if len(segments) != 2 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+	}
+	id, err := strconv.ParseInt(segments[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+	}
+	ref := &URLRef{ID: id, Secret: u.Query().Get("secret_token")}
+	switch segments[0] {
+	case "tracks":
+		ref.Kind = URLTrack
+	case "playlists":
+		ref.Kind = URLSet
+	case "users":
+		ref.Kind = URLUser
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, raw)
+	}
+	ref.URL = "https://api.soundcloud.com/" + segments[0] + "/" + segments[1]
+	if ref.Secret != "" {
+		ref.URL += "?secret_token=" + url.QueryEscape(ref.Secret)
+	}
+	return ref, nil
+}
+
+func isSecret(segment string) bool {
+	return strings.HasPrefix(segment, "s-") && len(segment) > 2
+}
+
+// canonicalURL builds the soundcloud.com url of ref.
+func (r *URLRef) canonicalURL() string {
+	path := []string{r.User}
+	switch r.Kind {
+	case URLTrack:
+		path = append(path, r.Slug)
+	case URLSet:
+		path = append(path, "sets", r.Slug)
+	case URLUserPlaylists:
+		path = append(path, "sets")
+	case URLUser:
+	default:
+		path = append(path, string(r.Kind))
+	}
+	if r.Secret != "" {
+		path = append(path, r.Secret)
+	}
+	return SoundCloudBaseURL + "/" + strings.Join(path, "/")
+}
+
+// ResolveURL is ParseURL for any SoundCloud link, following the redirects
+// of on.soundcloud.com and other short links.
+func (c *Client) ResolveURL(ctx context.Context, raw string) (*URLRef, error) {
+	u, err := parseLink(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !shortLinkHosts[u.Host] {
+		return ParseURL(raw)
+	}
+
+	// Only the redirects between short link hosts are followed; the
+	// location of the first one leaving them is the url.
+	client := *c.httpClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !shortLinkHosts[strings.ToLower(req.URL.Host)] {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	target := ""
+	err = c.Retry.do(ctx, func() error {
+		release, err := c.Limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return &retryableError{err: err}
+		}
+		defer resp.Body.Close()
+		location, err := resp.Location()
+		if err != nil {
+			return statusError(resp, fmt.Errorf("short link %s does not redirect: unexpected status %s", raw, resp.Status))
+		}
+		target = location.String()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow %s: %w", raw, err)
+	}
+	return ParseURL(target)
+}
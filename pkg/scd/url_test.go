@@ -0,0 +1,220 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want *URLRef
+	}{
+		{
+			name: "track",
+			url:  "https://soundcloud.com/artist/track",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "track without scheme",
+			url:  "soundcloud.com/artist/track",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "mobile track",
+			url:  "https://m.soundcloud.com/artist/track",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "www and upper case host",
+			url:  "https://WWW.SoundCloud.com/artist/track",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "tracking parameters and fragment",
+			url:  "https://soundcloud.com/artist/track?si=0123abcd&utm_source=clipboard&utm_medium=text&utm_campaign=social_sharing#t=1:23",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "track subpage",
+			url:  "https://soundcloud.com/artist/track/recommended",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "secret track",
+			url:  "https://soundcloud.com/artist/track/s-AbCdE123?si=x",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", Secret: "s-AbCdE123", URL: "https://soundcloud.com/artist/track/s-AbCdE123"},
+		},
+		{
+			name: "set",
+			url:  "https://soundcloud.com/artist/sets/album",
+			want: &URLRef{Kind: URLSet, User: "artist", Slug: "album", URL: "https://soundcloud.com/artist/sets/album"},
+		},
+		{
+			name: "secret set",
+			url:  "https://soundcloud.com/artist/sets/album/s-XyZ?utm_source=clipboard",
+			want: &URLRef{Kind: URLSet, User: "artist", Slug: "album", Secret: "s-XyZ", URL: "https://soundcloud.com/artist/sets/album/s-XyZ"},
+		},
+		{
+			name: "user",
+			url:  "https://soundcloud.com/artist/",
+			want: &URLRef{Kind: URLUser, User: "artist", URL: "https://soundcloud.com/artist"},
+		},
+		{
+			name: "user tracks",
+			url:  "https://soundcloud.com/artist/tracks",
+			want: &URLRef{Kind: URLUserTracks, User: "artist", URL: "https://soundcloud.com/artist/tracks"},
+		},
+		{
+			name: "user albums",
+			url:  "https://soundcloud.com/artist/albums",
+			want: &URLRef{Kind: URLUserAlbums, User: "artist", URL: "https://soundcloud.com/artist/albums"},
+		},
+		{
+			name: "user playlists",
+			url:  "https://soundcloud.com/artist/sets",
+			want: &URLRef{Kind: URLUserPlaylists, User: "artist", URL: "https://soundcloud.com/artist/sets"},
+		},
+		{
+			name: "user likes",
+			url:  "https://m.soundcloud.com/artist/likes",
+			want: &URLRef{Kind: URLUserLikes, User: "artist", URL: "https://soundcloud.com/artist/likes"},
+		},
+		{
+			name: "user reposts",
+			url:  "https://soundcloud.com/artist/reposts?utm_source=clipboard",
+			want: &URLRef{Kind: URLUserReposts, User: "artist", URL: "https://soundcloud.com/artist/reposts"},
+		},
+		{
+			name: "embed of a track page",
+			url:  "https://w.soundcloud.com/player/?url=https%3A%2F%2Fsoundcloud.com%2Fartist%2Ftrack&color=%23ff5500&auto_play=false",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{
+			name: "embed of an api track",
+			url:  "https://w.soundcloud.com/player/?url=https%3A//api.soundcloud.com/tracks/123456789&color=%23ff5500",
+			want: &URLRef{Kind: URLTrack, ID: 123456789, URL: "https://api.soundcloud.com/tracks/123456789"},
+		},
+		{
+			name: "embed of a secret api track",
+			url:  "https://w.soundcloud.com/player/?url=https%3A//api.soundcloud.com/tracks/123456789&secret_token=s-AbC",
+			want: &URLRef{Kind: URLTrack, ID: 123456789, Secret: "s-AbC", URL: "https://api.soundcloud.com/tracks/123456789?secret_token=s-AbC"},
+		},
+		{
+			name: "embed of an api playlist",
+			url:  "https://w.soundcloud.com/player/?url=https%3A%2F%2Fapi.soundcloud.com%2Fplaylists%2F42",
+			want: &URLRef{Kind: URLSet, ID: 42, URL: "https://api.soundcloud.com/playlists/42"},
+		},
+		{
+			name: "api user",
+			url:  "https://api-v2.soundcloud.com/users/7",
+			want: &URLRef{Kind: URLUser, ID: 7, URL: "https://api.soundcloud.com/users/7"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := ParseURL(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ref, test.want) {
+				t.Errorf("ParseURL(%q) =\n%+v\nwant\n%+v", test.url, ref, test.want)
+			}
+		})
+	}
+}
+
+func TestParseURLUnsupported(t *testing.T) {
+	for _, raw := range []string{
+		"https://soundcloud.com/",
+		"https://soundcloud.com/discover",
+		"https://soundcloud.com/search/sounds?q=track",
+		"https://soundcloud.com/artist/followers",
+		"https://api.soundcloud.com/tracks/not-a-number",
+		"https://api.soundcloud.com/comments/1",
+		"https://w.soundcloud.com/player/",
+		"https://www.youtube.com/watch?v=abc",
+		"https://on.soundcloud.com/AbCdE",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			if ref, err := ParseURL(raw); !errors.Is(err, ErrUnsupportedURL) {
+				t.Errorf("ParseURL(%q) = %+v, %v, want ErrUnsupportedURL", raw, ref, err)
+			}
+		})
+	}
+}
+
+// shortLinkTransport sends the requests for short link hosts to a test
+// server.
+type shortLinkTransport struct {
+	server *url.URL
+}
+
+func (t *shortLinkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !shortLinkHosts[req.URL.Host] {
+		return nil, errors.New("unexpected request to " + req.URL.String())
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.server.Scheme, t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestResolveShortLink(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/AbCdE", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://on.soundcloud.com/next", http.StatusFound)
+	})
+	mux.HandleFunc("/next", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://m.soundcloud.com/artist/sets/album/s-XyZ?ref=clipboard&p=i&c=1", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/goo", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://soundcloud.com/artist/likes", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	client := &Client{HTTPClient: &http.Client{Transport: &shortLinkTransport{server: serverURL}}, Retry: RetryPolicy{MaxAttempts: 1}}
+
+	tests := []struct {
+		url     string
+		want    *URLRef
+		wantErr bool
+	}{
+		{
+			url:  "https://on.soundcloud.com/AbCdE",
+			want: &URLRef{Kind: URLSet, User: "artist", Slug: "album", Secret: "s-XyZ", URL: "https://soundcloud.com/artist/sets/album/s-XyZ"},
+		},
+		{
+			url:  "soundcloud.app.goo.gl/goo",
+			want: &URLRef{Kind: URLUserLikes, User: "artist", URL: "https://soundcloud.com/artist/likes"},
+		},
+		{
+			url:  "https://soundcloud.com/artist/track",
+			want: &URLRef{Kind: URLTrack, User: "artist", Slug: "track", URL: "https://soundcloud.com/artist/track"},
+		},
+		{url: "https://on.soundcloud.com/missing", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			ref, err := client.ResolveURL(context.Background(), test.url)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("ResolveURL(%q) = %+v, want an error", test.url, ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ref, test.want) {
+				t.Errorf("ResolveURL(%q) =\n%+v\nwant\n%+v", test.url, ref, test.want)
+			}
+		})
+	}
+}
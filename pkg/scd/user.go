@@ -0,0 +1,210 @@
+package scd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UserCollection is a list on a user's profile that can be downloaded.
+type UserCollection string
+
+const (
+	UserUploads   UserCollection = "uploads"
+	UserAlbums    UserCollection = "albums"
+	UserPlaylists UserCollection = "playlists"
+	UserLikes     UserCollection = "likes"
+	UserReposts   UserCollection = "reposts"
+)
+
+// apiUserPageSize is the number of items asked for per page of a user
+// collection.
+const apiUserPageSize = 200
+
+// ParseUserCollections parses a comma separated list of collections, such
+// as "uploads,albums".
+func ParseUserCollections(value string) ([]UserCollection, error) {
+	collections := []UserCollection{}
+	for _, name := range strings.Split(value, ",") {
+		collection := UserCollection(strings.TrimSpace(name))
+		switch collection {
+		case UserUploads, UserAlbums, UserPlaylists, UserLikes, UserReposts:
+			collections = append(collections, collection)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown collection %q: must be uploads, albums, playlists, likes or reposts", name)
+		}
+	}
+	return collections, nil
+}
+
+// urlCollections maps the user subpages to the collection they show.
+var urlCollections = map[URLKind]UserCollection{
+	URLUserTracks:    UserUploads,
+	URLUserAlbums:    UserAlbums,
+	URLUserPlaylists: UserPlaylists,
+	URLUserLikes:     UserLikes,
+	URLUserReposts:   UserReposts,
+}
+
+// apiCollectionItem is an entry of the likes or reposts of a user, holding
+// either a track or a set.
+type apiCollectionItem struct {
+	Track    *apiTrack    `json:"track"`
+	Playlist *apiPlaylist `json:"playlist"`
+}
+
+// userCollectionPath returns the API endpoint listing collection, and
+// whether its entries wrap the tracks and sets.
+func userCollectionPath(userID int64, collection UserCollection) (string, bool) {
+	id := strconv.FormatInt(userID, 10)
+	switch collection {
+	case UserAlbums:
+		return "/users/" + id + "/albums", false
+	case UserPlaylists:
+		return "/users/" + id + "/playlists_without_albums", false
+	case UserLikes:
+		return "/users/" + id + "/likes", true
+	case UserReposts:
+		return "/stream/users/" + id + "/reposts", true
+	}
+	return "/users/" + id + "/tracks", false
+}
+
+// userItems pages through a collection of a user, following next_href
+// until the end of the list.
+func (a *APIClient) userItems(ctx context.Context, userID int64, collection UserCollection) ([]apiCollectionItem, error) {
+	next, wrapped := userCollectionPath(userID, collection)
+	query := url.Values{"limit": {strconv.Itoa(apiUserPageSize)}, "linked_partitioning": {"1"}}
+	items := []apiCollectionItem{}
+	for next != "" {
+		page := apiCollection[json.RawMessage]{}
+		if err := a.get(ctx, next, query, &page); err != nil {
+			return nil, err
+		}
+		for _, data := range page.Collection {
+			item := apiCollectionItem{}
+			var err error
+			switch {
+			case wrapped:
+				err = json.Unmarshal(data, &item)
+			case collection == UserUploads:
+				item.Track = &apiTrack{}
+				err = json.Unmarshal(data, item.Track)
+			default:
+				item.Playlist = &apiPlaylist{}
+				err = json.Unmarshal(data, item.Playlist)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s entry: %w", collection, err)
+			}
+			items = append(items, item)
+		}
+		if len(page.Collection) == 0 {
+			break
+		}
+		// next_href carries the query of the following page.
+		next, query = page.NextHref, nil
+	}
+	return items, nil
+}
+
+// info describes the set for downloading its tracks.
+func (p *apiPlaylist) info() setInfo {
+	return setInfo{id: p.ID, secret: p.SecretToken, url: p.PermalinkURL, title: p.Title, author: p.User.Username, trackCount: p.TrackCount, artworkURL: p.ArtworkURL, album: p.IsAlbum}
+}
+
+// user looks up the user a user page url points to.
+func (a *APIClient) user(ctx context.Context, ref *URLRef) (*apiUser, error) {
+	user := &apiUser{}
+	if ref.ID != 0 {
+		return user, a.get(ctx, "/users/"+strconv.FormatInt(ref.ID, 10), nil, user)
+	}
+	return user, a.resolve(ctx, SoundCloudBaseURL+"/"+ref.User, user)
+}
+
+// DownloadUser downloads collections of the user whose page, or subpage,
+// is at url: the uploads when no collection is given. Tracks are saved in
+// a directory named after the user, and each album or playlist in a
+// directory of its own. The lists and their sets are always read through
+// the API, as pages only show their first items.
+func (c *Client) DownloadUser(ctx context.Context, url string, collections ...UserCollection) error {
+	jobs, notAvailable, err := c.userJobs(ctx, url, collections...)
+	if len(jobs) == 0 {
+		return err
+	}
+	return errors.Join(err, jobsError(ctx, jobs, c.downloadJobs(ctx, jobs, notAvailable)))
+}
+
+// userJobs lists the tracks of collections of a user, with the number of
+// tracks left out as unavailable. Lists that cannot be read are reported
+// in the error, alongside the tracks of the others, and so are collections
+// with nothing to download.
+func (c *Client) userJobs(ctx context.Context, url string, collections ...UserCollection) ([]trackJob, int, error) {
+	ref, err := c.ResolveURL(ctx, url)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ref.Kind.IsUser() {
+		return nil, 0, fmt.Errorf("%w: %s is not a user page", ErrUnsupportedURL, url)
+	}
+	if len(collections) == 0 {
+		collections = []UserCollection{UserUploads}
+	}
+
+	api := c.api()
+	user, err := api.user(ctx, ref)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up %s: %w", url, err)
+	}
+
+	jobs := []trackJob{}
+	notAvailable := 0
+	errs := []error{}
+	for _, collection := range collections {
+		stop := c.startSpinner(fmt.Sprintf("Listing the %s of %s", collection, user.Username))
+		items, err := api.userItems(ctx, user.ID, collection)
+		stop()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list the %s of %s: %w", collection, user.Username, err))
+			continue
+		}
+
+		parentDir := fileName(user.Username, "", c.ASCIINames)
+		if collection == UserLikes || collection == UserReposts {
+			title := strings.ToUpper(string(collection[:1])) + string(collection[1:])
+			parentDir = fileName(user.Username+" - "+title, "", c.ASCIINames)
+		}
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			switch {
+			case item.Track != nil:
+				song := item.Track.songData()
+				if !song.Available {
+					notAvailable++
+					continue
+				}
+				jobs = append(jobs, trackJob{song: song, parentDir: parentDir})
+			case item.Playlist != nil:
+				set := item.Playlist
+				setJobs, skipped, err := c.setJobs(ctx, set.info(), c.setDir(set.Title, set.User.Username))
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				jobs = append(jobs, setJobs...)
+				notAvailable += skipped
+			}
+		}
+	}
+	if len(jobs) == 0 && len(errs) == 0 {
+		return nil, notAvailable, emptyError(url, notAvailable)
+	}
+	return jobs, notAvailable, errors.Join(errs...)
+}
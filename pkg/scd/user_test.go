@@ -0,0 +1,64 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadUserNothingToDownload(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracks string
+		want   error
+	}{
+		{"no uploads", ``, ErrNothingToDownload},
+		{"all blocked", `{"id":1,"title":"One","policy":"BLOCK"},{"id":2,"title":"Two","policy":"BLOCK"}`, ErrNotAvailable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/resolve":
+					fmt.Fprint(w, `{"id":7,"username":"Artist","permalink_url":"https://soundcloud.com/artist"}`)
+				case "/users/7/tracks":
+					fmt.Fprint(w, `{"collection":[`+test.tracks+`]}`)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+			client := &Client{API: &APIClient{BaseURL: server.URL, ClientID: freshClientID}, OutputDir: t.TempDir()}
+
+			if err := client.DownloadUser(context.Background(), "https://soundcloud.com/artist"); !errors.Is(err, test.want) {
+				t.Errorf("DownloadUser() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestListedSetTracksFromAPI(t *testing.T) {
+	server := newStandInAPI(t)
+	fetcher := &failingFetcher{err: errors.New("the page should not be loaded")}
+	client := &Client{Fetcher: fetcher}
+	client.defaultAPIOnce.Do(func() {
+		client.defaultAPI = server.client("")
+		client.defaultAPI.ClientID = freshClientID
+	})
+
+	// Without --api, a set listed by the API is still read from it.
+	songs, _, err := client.setTracks(context.Background(), setInfo{id: 40, url: "https://soundcloud.com/artist/sets/set", title: "Set"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(songs) != 3 || fetcher.calls != 0 {
+		t.Errorf("setTracks() = %d tracks with %d page loads, want 3 tracks and none", len(songs), fetcher.calls)
+	}
+	if want := []string{"/playlists/40?", "/tracks?2,3"}; strings.Join(server.requests, " ") != strings.Join(want, " ") {
+		t.Errorf("requests = %v, want %v", server.requests, want)
+	}
+}
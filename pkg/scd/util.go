@@ -1,6 +1,11 @@
 package scd
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
 
 func Colorize(color, text string) string {
 	// Map color names to ANSI escape codes
@@ -25,14 +30,44 @@ func Colorize(color, text string) string {
 	return fmt.Sprintf("\033[%sm%s\033[0m", code, text)
 }
 
-func createChunks[T any](slice *[]T, size int) [][]T {
-	chunks := [][]T{}
-	for i := 0; i < len(*slice); i += size {
-		end := i + size
-		if end > len(*slice) {
-			end = len(*slice)
+// startSpinner renders an indeterminate progress bar until the returned
+// function is called.
+func (c *Client) startSpinner(description string) func() {
+	if c.downloading.Load() > 0 {
+		return func() {}
+	}
+	return c.startSpinnerFunc(func() string { return description })
+}
+
+// startSpinnerFunc is startSpinner with a description that is refreshed
+// while the spinner runs.
+func (c *Client) startSpinnerFunc(describe func() string) func() {
+	description := describe()
+	bar := progressbar.NewOptions(-1, progressbar.OptionSetWriter(c.progress()), progressbar.OptionSetDescription(description), progressbar.OptionSetItsString(""), progressbar.OptionSpinnerType(11), progressbar.OptionClearOnFinish(), progressbar.OptionSetElapsedTime(false), progressbar.OptionSetRenderBlankState(true))
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if next := describe(); next != description {
+					description = next
+					bar.Describe(description)
+				}
+				bar.Add(1)
+				time.Sleep(100 * time.Millisecond)
+			}
 		}
-		chunks = append(chunks, (*slice)[i:end])
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		bar.Finish()
+		bar.Close()
 	}
-	return chunks
 }
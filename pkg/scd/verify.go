@@ -0,0 +1,43 @@
+package scd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// ErrVerificationFailed is returned when a finished download does not match
+// what its playlist and track metadata promised. The file is not saved.
+var ErrVerificationFailed = errors.New("download verification failed")
+
+// durationTolerance is how far the summed segment durations may drift from
+// the track duration reported by SoundCloud, on top of one percent of it.
+const durationTolerance = 2 * time.Second
+
+// verifyDownload checks the file at path before it is moved into place.
+// written is the number of segments muxed into it and expected the track
+// duration, or zero when unknown.
+func verifyDownload(path string, playlist *HLSPlaylist, written int, expected time.Duration) error {
+	if written != len(playlist.Segments) {
+		return fmt.Errorf("%w: wrote %d of %d segments", ErrVerificationFailed, written, len(playlist.Segments))
+	}
+
+	if expected > 0 {
+		actual := time.Duration(playlist.Duration() * float64(time.Second))
+		tolerance := durationTolerance + expected/100
+		if math.Abs(float64(actual-expected)) > float64(tolerance) {
+			return fmt.Errorf("%w: stream is %s long but the track is %s", ErrVerificationFailed, actual.Round(time.Second), expected.Round(time.Second))
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%w: output file is empty", ErrVerificationFailed)
+	}
+	return nil
+}
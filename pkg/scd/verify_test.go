@@ -0,0 +1,86 @@
+package scd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyDownload(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full.mp3")
+	empty := filepath.Join(dir, "empty.mp3")
+	os.WriteFile(full, mp3Frame, 0644)
+	os.WriteFile(empty, nil, 0644)
+	playlist := &HLSPlaylist{Segments: []HLSSegment{{Duration: 100}, {Duration: 100}, {Duration: 10}}}
+
+	tests := []struct {
+		name     string
+		path     string
+		written  int
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"matching", full, 3, 210 * time.Second, false},
+		{"within tolerance", full, 3, 214 * time.Second, false},
+		{"stream too short", full, 3, 215 * time.Second, true},
+		{"stream too long", full, 3, 205 * time.Second, true},
+		{"unknown duration", full, 3, 0, false},
+		{"missing segment", full, 2, 210 * time.Second, true},
+		{"empty file", empty, 3, 210 * time.Second, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyDownload(test.path, playlist, test.written, test.expected)
+			if test.wantErr != errors.Is(err, ErrVerificationFailed) {
+				t.Errorf("verifyDownload() error = %v, want failure %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadTrackDurationFromPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments int
+		wantErr  bool
+	}{
+		{"matching stream", 3, false},
+		{"truncated stream", 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/playlist.m3u8" {
+					w.Write(mp3Frame)
+					return
+				}
+				fmt.Fprint(w, "#EXTM3U\n"+strings.Repeat("#EXTINF:10,\n/segment.mp3\n", test.segments)+"#EXT-X-ENDLIST\n")
+			}))
+			defer server.Close()
+
+			// A search result in browser mode has no duration; the one of
+			// the track page is used.
+			song := &SongData{Title: "Night Drive", Author: "Artist", Url: "https://soundcloud.com/artist/night-drive", Available: true}
+			fetcher := &StaticFetcher{Dir: "testdata", Streams: map[string]string{song.Url: server.URL + "/playlist.m3u8"}}
+			dir := t.TempDir()
+			client := &Client{Fetcher: fetcher, OutputDir: dir, Retry: RetryPolicy{MaxAttempts: 1}}
+
+			err := client.DownloadTrack(context.Background(), song, "")
+			if test.wantErr != errors.Is(err, ErrVerificationFailed) {
+				t.Fatalf("DownloadTrack() error = %v, want failure %v", err, test.wantErr)
+			}
+			_, err = os.Stat(filepath.Join(dir, "Artist - Night Drive.mp3"))
+			if test.wantErr != os.IsNotExist(err) {
+				t.Errorf("saved file: %v", err)
+			}
+		})
+	}
+}